@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+// defaultRefreshWindow is the default of the -refresh-window flag.
+const defaultRefreshWindow = 5 * time.Minute
+
+// config holds the flags shared by the commands.
+type config struct {
+	idpid         string
+	spid          string
+	email         string
+	role          string
+	profile       string
+	region        string
+	refreshWindow time.Duration
+
+	// in and out are the terminal the prompts are answered on, stdin and
+	// stderr unless set before newGSuite.
+	in  *os.File
+	out *os.File
+
+	prompter saml.Prompter
+}
+
+func (c *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.idpid, "idpid", os.Getenv("GSUITE_IDPID"), "Google identity provider ID (GSUITE_IDPID)")
+	fs.StringVar(&c.spid, "spid", os.Getenv("GSUITE_SPID"), "Google service provider ID (GSUITE_SPID)")
+	fs.StringVar(&c.email, "email", os.Getenv("GSUITE_EMAIL"), "Google account email (GSUITE_EMAIL)")
+	fs.StringVar(&c.role, "role", "", "ARN or account/role name of the role to assume, defaults to the role saved in the profile")
+	fs.StringVar(&c.profile, "profile", envOr("AWS_PROFILE", "default"), "AWS profile (AWS_PROFILE)")
+	fs.StringVar(&c.region, "region", "", "AWS region saved in the profile")
+	fs.DurationVar(&c.refreshWindow, "refresh-window", defaultRefreshWindow, "renew the credentials this long before they expire")
+}
+
+func envOr(key, value string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+
+	return value
+}
+
+// newGSuite returns a *saml.GSuite that prompts on the terminal, leaving
+// stdout to the output of the command.
+func (c *config) newGSuite() (*saml.GSuite, error) {
+	if c.idpid == "" || c.spid == "" {
+		return nil, errors.New("the identity and service provider IDs are required, set -idpid and -spid")
+	}
+
+	if c.in == nil {
+		c.in, c.out = os.Stdin, os.Stderr
+	}
+
+	c.prompter = saml.NewTerminalPrompter(c.in, c.out)
+
+	return saml.NewGSuiteSAMLLogin(c.idpid, c.spid, c.prompter, saml.WithRefreshWindow(c.refreshWindow))
+}
+
+// password returns GSUITE_PASSWORD, or reads the password from the terminal.
+func (c *config) password() (string, error) {
+	if p, ok := os.LookupEnv("GSUITE_PASSWORD"); ok {
+		return p, nil
+	}
+
+	fd := int(c.in.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("a password is required, set GSUITE_PASSWORD")
+	}
+
+	fmt.Fprint(c.out, "Password: ")
+
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(c.out)
+
+	return string(p), err
+}
+
+// authenticate logs in and retrieves the credentials of the role of the
+// profile, for as long as the role allows. The returned profile is the one
+// to save along with the credentials.
+func (c *config) authenticate(ctx context.Context, g *saml.GSuite) (*sts.Credentials, saml.Profile, error) {
+	profile, err := g.LoadProfile(c.profile)
+	if err != nil {
+		return nil, profile, err
+	}
+
+	if c.region != "" {
+		profile.Region = c.region
+	}
+
+	if c.email == "" {
+		return nil, profile, errors.New("an email is required, set -email or GSUITE_EMAIL")
+	}
+
+	p, err := c.password()
+	if err != nil {
+		return nil, profile, err
+	}
+
+	accounts, err := g.LoginContext(ctx, c.email, p)
+	if err != nil {
+		return nil, profile, err
+	}
+
+	if profile.RoleARN, err = c.selectRole(ctx, accounts, profile.RoleARN); err != nil {
+		return nil, profile, err
+	}
+
+	o, granted, err := g.RetrieveMaxDurationCredentialsContext(ctx, profile.RoleARN)
+	if err != nil {
+		return nil, profile, err
+	}
+
+	fmt.Fprintf(c.out, "Session granted for %s\n", time.Duration(granted)*time.Second)
+
+	// The account is derived from the role, which may have changed.
+	profile.AccountID = ""
+
+	return o.Credentials, profile, nil
+}
+
+// savedRole reports whether the role given by -role, if any, is the role
+// saved in the profile p. An account alias cannot be resolved without logging
+// in, so a role named after one never matches.
+func (c *config) savedRole(p saml.Profile) bool {
+	switch {
+	case c.role == "":
+		return true
+	case strings.HasPrefix(c.role, "arn:"):
+		return c.role == p.RoleARN
+	}
+
+	saved, err := arn.Parse(p.RoleARN)
+	if err != nil {
+		return false
+	}
+
+	i := strings.LastIndex(c.role, "/")
+
+	return i >= 0 && c.role[:i] == saved.AccountID && strings.HasPrefix(saved.Resource, "role/") && strings.HasSuffix(saved.Resource, "/"+c.role[i+1:])
+}
+
+// cachedRole reports whether credentials cached for the role roleARN are for
+// the role given by -role or, without it, the role saved in the profile p.
+func (c *config) cachedRole(p saml.Profile, roleARN string) bool {
+	if c.role == "" && p.RoleARN != "" {
+		return roleARN == p.RoleARN
+	}
+
+	return c.savedRole(saml.Profile{RoleARN: roleARN})
+}
+
+// selectRole returns the ARN of the role given by -role, the role saved in
+// the profile, or the role picked by the user.
+func (c *config) selectRole(ctx context.Context, accounts saml.Accounts, saved string) (string, error) {
+	switch {
+	case strings.HasPrefix(c.role, "arn:"):
+		return c.role, nil
+	case c.role != "":
+		i := strings.LastIndex(c.role, "/")
+		if i < 0 {
+			return "", errors.Errorf("invalid role %q, expected an ARN or account/role", c.role)
+		}
+
+		role, err := accounts.Role(c.role[:i], c.role[i+1:])
+		if err != nil {
+			return "", err
+		}
+
+		return role.ARN.String(), nil
+	case saved != "":
+		return saved, nil
+	}
+
+	arns := []string{}
+	options := []string{}
+
+	for _, account := range accounts {
+		for _, role := range account.Roles {
+			arns = append(arns, role.ARN.String())
+			options = append(options, fmt.Sprintf("%s\t%s", account.Name, role.ARN))
+		}
+	}
+
+	if len(arns) == 1 {
+		return arns[0], nil
+	}
+
+	i, err := c.prompter.Select(ctx, "Select a role:", options)
+	if err != nil {
+		return "", err
+	}
+
+	return arns[i], nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+func TestSavedRole(t *testing.T) {
+	const saved = "arn:aws:iam::123456789012:role/admin"
+
+	for _, tt := range []struct {
+		role     string
+		saved    string
+		expected bool
+	}{
+		{"", saved, true},
+		{"", "", true},
+		{saved, saved, true},
+		{"arn:aws:iam::123456789012:role/readonly", saved, false},
+		{"123456789012/admin", saved, true},
+		{"123456789012/readonly", saved, false},
+		{"210987654321/admin", saved, false},
+		// A role with a path is named after its last path element.
+		{"123456789012/admin", "arn:aws:iam::123456789012:role/team/admin", true},
+		{"123456789012/team", "arn:aws:iam::123456789012:role/team/admin", false},
+		// An alias cannot be resolved without logging in.
+		{"production/admin", saved, false},
+		{"admin", saved, false},
+		{"123456789012/admin", "", false},
+		{"123456789012/admin", "arn:aws:iam::123456789012:user/admin", false},
+	} {
+		c := &config{role: tt.role}
+
+		if actual := c.savedRole(saml.Profile{RoleARN: tt.saved}); actual != tt.expected {
+			t.Errorf("role %q saved as %q: expected %v, got %v", tt.role, tt.saved, tt.expected, actual)
+		}
+	}
+}
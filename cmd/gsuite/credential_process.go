@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+var credentialProcessCommand = &command{
+	name:    "credential-process",
+	summary: "print the credentials of a profile for the credential_process of the AWS SDKs",
+	run:     runCredentialProcess,
+}
+
+// runCredentialProcess prints the credentials of the profile in the
+// credential_process format, logging in only when the cached credentials
+// expire within the refresh window. With -configure, it instead sets itself
+// as the credential_process of the profile.
+func runCredentialProcess(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("credential-process", flag.ContinueOnError)
+
+	var c config
+
+	c.register(fs)
+
+	configure := fs.Bool("configure", false, "write the credential_process of the profile to the AWS config file")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The AWS CLI captures the output of the credential_process, so the
+	// prompts go to the terminal.
+	in, out, ttyErr := openTerminal()
+	if ttyErr == nil {
+		defer in.Close()
+
+		if out != in {
+			defer out.Close()
+		}
+
+		c.in, c.out = in, out
+	}
+
+	g, err := c.newGSuite()
+	if err != nil {
+		return err
+	}
+
+	if *configure {
+		return configureCredentialProcess(g, &c)
+	}
+
+	creds, role, err := g.CachedProcessCredentials(c.profile)
+	if err != nil {
+		return err
+	}
+
+	profile, err := g.LoadProfile(c.profile)
+	if err != nil {
+		return err
+	}
+
+	if creds == nil || !c.cachedRole(profile, role) {
+		if ttyErr != nil {
+			return errors.Wrapf(ttyErr, "cannot log in without a terminal, run %s credential-process -profile %s in a terminal first", os.Args[0], c.profile)
+		}
+
+		if creds, profile, err = c.authenticate(ctx, g); err != nil {
+			return err
+		}
+
+		if err = g.CacheProcessCredentials(c.profile, profile.RoleARN, creds); err != nil {
+			return err
+		}
+	}
+
+	return saml.WriteProcessCredentials(os.Stdout, creds)
+}
+
+func configureCredentialProcess(g *saml.GSuite, c *config) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	args := []string{exe, "credential-process", "-idpid", c.idpid, "-spid", c.spid, "-profile", c.profile}
+
+	if c.email != "" {
+		args = append(args, "-email", c.email)
+	}
+
+	if c.refreshWindow != defaultRefreshWindow {
+		args = append(args, "-refresh-window", c.refreshWindow.String())
+	}
+
+	profile := saml.Profile{Name: c.profile, Region: c.region}
+
+	// An account/role name is resolved at login, an ARN is saved with the
+	// profile.
+	if strings.HasPrefix(c.role, "arn:") {
+		profile.RoleARN = c.role
+	} else if c.role != "" {
+		args = append(args, "-role", c.role)
+	}
+
+	if err = g.ConfigureCredentialProcess(profile, args...); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Profile %s now gets its credentials from %s\n", c.profile, exe)
+
+	return nil
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+func TestCredentialProcessRole(t *testing.T) {
+	for _, tt := range []struct {
+		role     string
+		saved    string
+		expected string
+	}{
+		{"", "", "AKID"},
+		{"", testRoleARN, "AKID"},
+		{testRoleARN, "", "AKID"},
+		{"123456789012/admin", "", "AKID"},
+		// Credentials of another role are not returned, and logging in
+		// requires a terminal.
+		{"arn:aws:iam::123456789012:role/readonly", "", ""},
+		{"210987654321/admin", "", ""},
+		{"", "arn:aws:iam::123456789012:role/readonly", ""},
+	} {
+		cmd := gsuite(t, "credential-process", "-profile", "test", "-role", tt.role)
+
+		if tt.saved != "" {
+			config := "[profile test]\ngsuite_role_arn = " + tt.saved + "\n"
+
+			if err := ioutil.WriteFile(os.Getenv("AWS_CONFIG_FILE"), []byte(config), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Start a session without a controlling terminal, as a
+		// credential_process run by a daemon would.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+		var stdout, stderr bytes.Buffer
+
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		err := cmd.Run()
+
+		if tt.expected == "" {
+			if err == nil || !strings.Contains(stderr.String(), "in a terminal first") {
+				t.Errorf("role %q: expected to require a terminal, got %v: %s", tt.role, err, stderr.String())
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("role %q: %v: %s", tt.role, err, stderr.String())
+		}
+
+		var creds saml.ProcessCredentials
+
+		if err = json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+			t.Fatal(err)
+		}
+
+		if creds.AccessKeyID != tt.expected {
+			t.Errorf("role %q: expected the cached credentials, got %v", tt.role, creds)
+		}
+	}
+}
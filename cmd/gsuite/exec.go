@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+var execCommand = &command{
+	name:    "exec",
+	summary: "run a command with the credentials of a profile in its environment",
+	run:     runExec,
+}
+
+// exitCode is returned to exit with the status of the command run by exec.
+// It is only used where exec cannot replace the process with the command.
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// runExec runs a command with the credentials of the profile exported in its
+// environment. Valid credentials cached by credential-process are reused,
+// otherwise the user logs in. The credentials are never written to disk.
+func runExec(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s exec [flags] <profile> -- <command> [args...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	var c config
+
+	c.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+
+	if len(args) < 2 {
+		fs.Usage()
+
+		return flag.ErrHelp
+	}
+
+	c.profile = args[0]
+
+	g, err := c.newGSuite()
+	if err != nil {
+		return err
+	}
+
+	creds, role, err := g.CachedProcessCredentials(c.profile)
+	if err != nil {
+		return err
+	}
+
+	profile, err := g.LoadProfile(c.profile)
+	if err != nil {
+		return err
+	}
+
+	if creds == nil || !c.cachedRole(profile, role) {
+		if creds, profile, err = c.authenticate(ctx, g); err != nil {
+			return err
+		}
+	}
+
+	region := profile.Region
+	if c.region != "" {
+		region = c.region
+	}
+
+	path, err := exec.LookPath(args[1])
+	if err != nil {
+		return err
+	}
+
+	return runCommand(path, args[1:], saml.CredentialsEnv(os.Environ(), creds, region))
+}
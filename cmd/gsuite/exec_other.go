@@ -0,0 +1,48 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// runCommand runs the command at path and returns its exit status as an
+// exitCode. Ctrl-C is delivered by the console to the command as well, so
+// the interrupt is ignored rather than forwarded, which would deliver it
+// twice.
+func runCommand(path string, args, env []string) error {
+	signal.Ignore(os.Interrupt)
+
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "failed to run %s", path)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+
+	defer signal.Stop(sig)
+
+	go func() {
+		for s := range sig {
+			cmd.Process.Signal(s)
+		}
+	}()
+
+	err := cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitCode(exitErr.ExitCode())
+	}
+
+	return err
+}
@@ -0,0 +1,146 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+// TestMain runs the command instead of the tests when GSUITE_TEST_MAIN is
+// set, so that the tests can run the test binary as gsuite.
+func TestMain(m *testing.M) {
+	if os.Getenv("GSUITE_TEST_MAIN") == "1" {
+		main()
+
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testRoleARN is the role of the credentials cached by gsuite.
+const testRoleARN = "arn:aws:iam::123456789012:role/admin"
+
+// gsuite returns the command running gsuite with args, with credentials of
+// testRoleARN cached for the profile test by credential-process.
+func gsuite(t *testing.T, args ...string) *exec.Cmd {
+	dir := t.TempDir()
+
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("GSUITE_IDPID", "idpid")
+	t.Setenv("GSUITE_SPID", "spid")
+	t.Setenv("GSUITE_EMAIL", "")
+
+	g, err := saml.NewGSuiteSAMLLogin("idpid", "spid", saml.NonInteractivePrompter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.CacheProcessCredentials("test", testRoleARN, &sts.Credentials{
+		AccessKeyId:     aws.String("AKID"),
+		SecretAccessKey: aws.String("SECRET"),
+		SessionToken:    aws.String("TOKEN"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GSUITE_TEST_MAIN=1")
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
+
+func TestExecExitCode(t *testing.T) {
+	cmd := gsuite(t, "exec", "test", "--", "sh", "-c", `test "$AWS_ACCESS_KEY_ID" = AKID || exit 1; exit 7`)
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 7 {
+		t.Errorf("expected exit status 7, got %v", err)
+	}
+}
+
+func TestExecSignals(t *testing.T) {
+	// The script counts the signals received while its sleep runs.
+	script := `
+echo $$
+i=0
+t=0
+trap 'i=$((i+1))' INT
+trap 't=$((t+1))' TERM
+sleep 1 &
+pid=$!
+echo ready
+while kill -0 $pid 2>/dev/null; do wait $pid; done
+echo "$i $t"
+`
+
+	cmd := gsuite(t, "exec", "test", "--", "sh", "-c", script)
+
+	// Run in a process group of its own, as the foreground job of a
+	// terminal would.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(out)
+
+	// Signals sent together are merged, so the count alone would not catch
+	// a process forwarding them: the command must replace gsuite.
+	if line, err := r.ReadString('\n'); err != nil || line != strconv.Itoa(cmd.Process.Pid)+"\n" {
+		cmd.Process.Kill()
+		t.Fatalf("expected the command to run as pid %d, got %q (%v)", cmd.Process.Pid, line, err)
+	}
+
+	if line, err := r.ReadString('\n'); err != nil || line != "ready\n" {
+		cmd.Process.Kill()
+		t.Fatalf("expected ready, got %q (%v)", line, err)
+	}
+
+	// Ctrl-C signals the whole process group, kill only the process.
+	if err = syscall.Kill(-cmd.Process.Pid, syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(line) != "1 1" {
+		t.Errorf("expected one SIGINT and one SIGTERM, got %q", line)
+	}
+}
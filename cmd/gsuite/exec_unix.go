@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// runCommand replaces the process with the command at path. The command
+// thus receives the signals sent to exec, such as the SIGINT of Ctrl-C sent
+// to the whole foreground process group, exactly once, and exits with its own
+// status.
+func runCommand(path string, args, env []string) error {
+	return errors.Wrapf(syscall.Exec(path, args, env), "failed to run %s", path)
+}
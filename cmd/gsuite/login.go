@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+var loginCommand = &command{
+	name:    "login",
+	summary: "save the credentials of a role to a profile",
+	run:     runLogin,
+}
+
+// runLogin saves credentials to the profile, unless the credentials already
+// saved for the role are valid for longer than the refresh window.
+func runLogin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+
+	var c config
+
+	c.register(fs)
+
+	force := fs.Bool("force", false, "log in even if the saved credentials are still valid")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	g, err := c.newGSuite()
+	if err != nil {
+		return err
+	}
+
+	if !*force {
+		saved, err := g.LoadProfile(c.profile)
+		if err != nil {
+			return err
+		}
+
+		creds, err := g.CachedCredentials(c.profile)
+		if err != nil {
+			return err
+		}
+
+		if creds != nil && c.savedRole(saved) {
+			fmt.Fprintf(os.Stderr, "Credentials of profile %s are valid until %s\n", c.profile, creds.Expiration.Local().Format(time.RFC1123))
+
+			// A new region needs no new credentials.
+			if c.region != "" && c.region != saved.Region {
+				saved.Region = c.region
+
+				return g.SaveProfile(saved, creds)
+			}
+
+			return nil
+		}
+	}
+
+	creds, profile, err := c.authenticate(ctx, g)
+	if err != nil {
+		return err
+	}
+
+	return g.SaveProfile(profile, creds)
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// openTerminal fails, the platform has no terminal to open.
+func openTerminal() (in, out *os.File, err error) {
+	return nil, nil, errors.New("no terminal")
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import "os"
+
+// openTerminal opens the controlling terminal of the process.
+func openTerminal() (in, out *os.File, err error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tty, tty, nil
+}
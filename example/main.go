@@ -1,44 +1,38 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/talos-systems/go-gsuite/saml"
 )
 
-func prompt(accounts []saml.Account) (arn string) {
+func prompt(p saml.Prompter, accounts []saml.Account) (arn string) {
 	arns := []string{}
+	options := []string{}
 	for _, account := range accounts {
-		fmt.Printf("%s\n", account.Name)
 		for _, role := range account.Roles {
-			arns = append(arns, role.ARN)
-			fmt.Printf("[%d]: \t%s\n", len(arns), role.ARN)
+			arns = append(arns, role.ARN.String())
+			options = append(options, fmt.Sprintf("%s\t%s", account.Name, role.ARN))
 		}
 	}
 
-	fmt.Printf("Select and ARN: ")
-	var i int
-	_, err := fmt.Scanf("%d", &i)
+	i, err := p.Select(context.Background(), "Select an ARN:", options)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if len(arns) < i {
-		return
-	}
-
-	// Decrement by 1 to take into consideration that we prompt starting at
-	// 1.
-	i--
-
 	fmt.Printf("Retrieving credentials for ARN: %s\n", arns[i])
 
 	return arns[i]
 }
 
 func main() {
-	g, err := saml.NewGSuiteSAMLLogin("", "")
+	p := saml.NewDefaultPrompter()
+
+	g, err := saml.NewGSuiteSAMLLogin("", "", p)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -48,15 +42,16 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	arn := prompt(accounts)
+	arn := prompt(p, accounts)
 
-	o, err := g.RetrieveAWSCredentials(
-		"",
-		arn,
-	)
+	o, granted, err := g.RetrieveMaxDurationCredentials(arn)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	g.SaveAWSCredentials(o, "")
+	fmt.Printf("Session granted for %s\n", time.Duration(granted)*time.Second)
+
+	if err = g.SaveProfile(saml.Profile{RoleARN: arn}, o.Credentials); err != nil {
+		log.Fatal(err.Error())
+	}
 }
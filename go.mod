@@ -1,15 +1,20 @@
 module github.com/talos-systems/go-gsuite
 
-go 1.12
+go 1.23.0
 
 require (
 	github.com/PuerkitoBio/goquery v1.2.0
+	github.com/aws/aws-sdk-go v1.38.20
+	github.com/beevik/etree v1.8.1
+	github.com/pkg/errors v0.9.1
+	github.com/russellhaering/goxmldsig v1.6.1
+	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b
+	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
+)
+
+require (
 	github.com/andybalholm/cascadia v0.0.0-20161224141413-349dd0209470 // indirect
-	github.com/aws/aws-sdk-go v1.19.11
-	github.com/go-ini/ini v1.32.0
-	github.com/pkg/errors v0.8.1
-	github.com/smartystreets/goconvey v0.0.0-20190330032615-68dc04aab96a // indirect
-	github.com/stretchr/testify v1.3.0 // indirect
-	golang.org/x/net v0.0.0-20190311183353-d8887717615a
-	gopkg.in/ini.v1 v1.42.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/jonboulle/clockwork v0.5.0 // indirect
 )
@@ -0,0 +1,105 @@
+package saml
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+)
+
+// Account represents an AWS account.
+type Account struct {
+	// Name is the name displayed by the AWS role picker, e.g.
+	// "Account: my-alias (123456789012)".
+	Name  string
+	ID    string
+	Alias string
+	Roles []Role
+}
+
+// Role represents and AWS role.
+type Role struct {
+	// Name is the name of the role without its path, e.g. "Admin".
+	Name         string
+	ARN          *arn.ARN
+	AccountID    string
+	PrincipalARN *arn.ARN
+}
+
+// Accounts is a list of accounts with lookup helpers.
+type Accounts []Account
+
+// accountName matches the account names of the AWS role picker.
+var accountName = regexp.MustCompile(`^Account:\s*(?:(.*\S)\s+\((\d{12})\)|(\d{12}))$`)
+
+// parseAccountName returns the alias and the ID of the account named name by
+// the AWS role picker. The alias is empty when the account has none.
+func parseAccountName(name string) (alias, id string, ok bool) {
+	m := accountName.FindStringSubmatch(strings.TrimSpace(name))
+	if m == nil {
+		return "", "", false
+	}
+
+	if m[3] != "" {
+		return "", m[3], true
+	}
+
+	return m[1], m[2], true
+}
+
+// roleName returns the name of a role without its path.
+func roleName(a arn.ARN) string {
+	return a.Resource[strings.LastIndex(a.Resource, "/")+1:]
+}
+
+// Role returns the role of the account named name, or the role with the ARN
+// name.
+func (a *Account) Role(name string) (Role, bool) {
+	for _, role := range a.Roles {
+		if role.Name == name || (role.ARN != nil && role.ARN.String() == name) {
+			return role, true
+		}
+	}
+
+	return Role{}, false
+}
+
+// Account returns the account with the ID or the alias idOrAlias.
+func (accounts Accounts) Account(idOrAlias string) (*Account, bool) {
+	for i := range accounts {
+		if accounts[i].ID == idOrAlias || (accounts[i].Alias != "" && accounts[i].Alias == idOrAlias) {
+			return &accounts[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Role returns the role named role, or with the ARN role, of the account
+// with the ID or the alias account. It returns an error wrapping
+// ErrRoleNotGranted when there is no such role.
+func (accounts Accounts) Role(account, role string) (Role, error) {
+	a, ok := accounts.Account(account)
+	if !ok {
+		return Role{}, errors.Wrapf(ErrRoleNotGranted, "no role in account %s", account)
+	}
+
+	r, ok := a.Role(role)
+	if !ok {
+		return Role{}, errors.Wrapf(ErrRoleNotGranted, "no role %s in account %s", role, account)
+	}
+
+	return r, nil
+}
+
+// RolesNamed returns the roles named name in every account.
+func (accounts Accounts) RolesNamed(name string) (roles []Role) {
+	for _, a := range accounts {
+		if role, ok := a.Role(name); ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
@@ -0,0 +1,94 @@
+package saml
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseAccountName(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		alias string
+		id    string
+		ok    bool
+	}{
+		{"Account: my-alias (123456789012)", "my-alias", "123456789012", true},
+		{"  Account: my alias (123456789012)\n", "my alias", "123456789012", true},
+		{"Account: 123456789012", "", "123456789012", true},
+		{"Account: my-alias", "", "", false},
+		{"", "", "", false},
+	} {
+		alias, id, ok := parseAccountName(tc.name)
+		if alias != tc.alias || id != tc.id || ok != tc.ok {
+			t.Errorf("%q: expected (%q, %q, %v), got (%q, %q, %v)", tc.name, tc.alias, tc.id, tc.ok, alias, id, ok)
+		}
+	}
+}
+
+func TestScrapeAWSInfo(t *testing.T) {
+	accounts, err := scrapeAWSInfo(loadFixture(t, "aws_role_picker.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %+v", accounts)
+	}
+
+	if accounts[0].ID != "123456789012" || accounts[0].Alias != "my-alias" {
+		t.Errorf("unexpected account %+v", accounts[0])
+	}
+
+	if accounts[1].ID != "210987654321" || accounts[1].Alias != "" {
+		t.Errorf("unexpected account %+v", accounts[1])
+	}
+
+	role, err := accounts.Role("210987654321", "Deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role.ARN.String() != "arn:aws:iam::210987654321:role/ops/Deploy" || role.AccountID != "210987654321" {
+		t.Errorf("unexpected role %+v", role)
+	}
+}
+
+func TestAccountsLookup(t *testing.T) {
+	a, err := ParseSAMLResponse(loadSAMLResponse(t, "saml_response.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := a.Accounts()
+	accounts[0].Alias = "dev"
+
+	if account, ok := accounts.Account("dev"); !ok || account.ID != "123456789012" {
+		t.Errorf("expected account 123456789012 by alias, got %+v", account)
+	}
+
+	role, err := accounts.Role("123456789012", "ReadOnly")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role.PrincipalARN.String() != "arn:aws:iam::123456789012:saml-provider/GoogleApps" {
+		t.Errorf("unexpected principal %s", role.PrincipalARN)
+	}
+
+	if role, err = accounts.Role("dev", "arn:aws:iam::123456789012:role/Admin"); err != nil || role.Name != "Admin" {
+		t.Errorf("expected role Admin by ARN, got %+v, %v", role, err)
+	}
+
+	if _, err = accounts.Role("dev", "Deploy"); !errors.Is(err, ErrRoleNotGranted) {
+		t.Errorf("expected %v, got %v", ErrRoleNotGranted, err)
+	}
+
+	if _, err = accounts.Role("unknown", "Admin"); !errors.Is(err, ErrRoleNotGranted) {
+		t.Errorf("expected %v, got %v", ErrRoleNotGranted, err)
+	}
+
+	if roles := accounts.RolesNamed("Deploy"); len(roles) != 1 || roles[0].AccountID != "210987654321" {
+		t.Errorf("unexpected roles %+v", roles)
+	}
+}
@@ -0,0 +1,280 @@
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+)
+
+// The SAML attributes AWS reads from the assertion.
+const (
+	attributeRole            = "https://aws.amazon.com/SAML/Attributes/Role"
+	attributeRoleSessionName = "https://aws.amazon.com/SAML/Attributes/RoleSessionName"
+	attributeSessionDuration = "https://aws.amazon.com/SAML/Attributes/SessionDuration"
+	attributeSourceIdentity  = "https://aws.amazon.com/SAML/Attributes/SourceIdentity"
+	attributePrincipalTag    = "https://aws.amazon.com/SAML/Attributes/PrincipalTag:"
+	attributeTransitiveTags  = "https://aws.amazon.com/SAML/Attributes/TransitiveTagKeys"
+)
+
+// statusSuccess is the status code of a successful SAML response.
+const statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+// Assertion is the SAML assertion issued by Google.
+type Assertion struct {
+	// Issuer is the entity ID of the IdP.
+	Issuer string
+	// Destination is the URL the SAML response is meant to be posted to.
+	Destination string
+	// Recipient is the URL the assertion is meant to be delivered to.
+	Recipient string
+	// Subject is the NameID of the user, usually the email.
+	Subject  string
+	Audience []string
+
+	NotBefore    time.Time
+	NotOnOrAfter time.Time
+
+	RoleSessionName string
+	// SessionDuration is zero when the IdP does not assert a duration.
+	SessionDuration time.Duration
+	Roles           []AssertionRole
+
+	// SourceIdentity, PrincipalTags and TransitiveTagKeys are set on the
+	// session of the role assumed with the assertion.
+	SourceIdentity    string
+	PrincipalTags     map[string]string
+	TransitiveTagKeys []string
+
+	// Attributes holds the values of every attribute, keyed by name.
+	Attributes map[string][]string
+
+	raw []byte
+}
+
+// AssertionRole is a role/principal pair of the Role attribute.
+type AssertionRole struct {
+	RoleARN      arn.ARN
+	PrincipalARN arn.ARN
+}
+
+type xmlResponse struct {
+	XMLName     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Destination string   `xml:"Destination,attr"`
+	Issuer      string   `xml:"Issuer"`
+	Status      struct {
+		Code struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"StatusCode"`
+	} `xml:"Status"`
+	Assertion *xmlAssertion `xml:"Assertion"`
+}
+
+type xmlAssertion struct {
+	Issuer  string `xml:"Issuer"`
+	Subject struct {
+		NameID       string `xml:"NameID"`
+		Confirmation struct {
+			Recipient    string `xml:"Recipient,attr"`
+			NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+		} `xml:"SubjectConfirmation>SubjectConfirmationData"`
+	} `xml:"Subject"`
+	Conditions struct {
+		NotBefore    string   `xml:"NotBefore,attr"`
+		NotOnOrAfter string   `xml:"NotOnOrAfter,attr"`
+		Audience     []string `xml:"AudienceRestriction>Audience"`
+	} `xml:"Conditions"`
+	Attributes []struct {
+		Name   string   `xml:"Name,attr"`
+		Values []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+// ParseSAMLResponse decodes the base64 encoded SAMLResponse posted by Google
+// and parses its assertion.
+func ParseSAMLResponse(samlResponse string) (*Assertion, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(samlResponse))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode SAMLResponse")
+	}
+
+	return ParseAssertion(raw)
+}
+
+// ParseAssertion parses the XML of a SAML response.
+func ParseAssertion(raw []byte) (a *Assertion, err error) {
+	var r xmlResponse
+	if err = xml.Unmarshal(raw, &r); err != nil {
+		return nil, errors.Wrap(err, "failed to parse SAML response")
+	}
+
+	if status := r.Status.Code.Value; status != "" && status != statusSuccess {
+		return nil, errors.Errorf("SAML response status is %s", status)
+	}
+
+	if r.Assertion == nil {
+		return nil, errors.New("SAML response has no assertion")
+	}
+
+	return newAssertion(r.Destination, r.Issuer, r.Assertion, raw)
+}
+
+// newAssertion builds an Assertion out of the parsed XML. The destination
+// and issuer of the response are used when the assertion does not set them.
+func newAssertion(destination, issuer string, x *xmlAssertion, raw []byte) (a *Assertion, err error) {
+	a = &Assertion{
+		Issuer:      x.Issuer,
+		Destination: destination,
+		Recipient:   x.Subject.Confirmation.Recipient,
+		Subject:     strings.TrimSpace(x.Subject.NameID),
+		Audience:    x.Conditions.Audience,
+		Attributes:  map[string][]string{},
+		raw:         raw,
+	}
+
+	if a.Issuer == "" {
+		a.Issuer = issuer
+	}
+
+	if a.NotBefore, err = parseInstant(x.Conditions.NotBefore); err != nil {
+		return nil, errors.Wrap(err, "invalid NotBefore")
+	}
+
+	notOnOrAfter := x.Conditions.NotOnOrAfter
+	if notOnOrAfter == "" {
+		notOnOrAfter = x.Subject.Confirmation.NotOnOrAfter
+	}
+
+	if a.NotOnOrAfter, err = parseInstant(notOnOrAfter); err != nil {
+		return nil, errors.Wrap(err, "invalid NotOnOrAfter")
+	}
+
+	for _, attr := range x.Attributes {
+		for _, value := range attr.Values {
+			a.Attributes[attr.Name] = append(a.Attributes[attr.Name], strings.TrimSpace(value))
+		}
+	}
+
+	if values := a.Attributes[attributeRoleSessionName]; len(values) > 0 {
+		a.RoleSessionName = values[0]
+	}
+
+	if values := a.Attributes[attributeSourceIdentity]; len(values) > 0 {
+		a.SourceIdentity = values[0]
+	}
+
+	a.TransitiveTagKeys = a.Attributes[attributeTransitiveTags]
+
+	for name, values := range a.Attributes {
+		if strings.HasPrefix(name, attributePrincipalTag) && len(values) > 0 {
+			if a.PrincipalTags == nil {
+				a.PrincipalTags = map[string]string{}
+			}
+
+			a.PrincipalTags[strings.TrimPrefix(name, attributePrincipalTag)] = values[0]
+		}
+	}
+
+	if values := a.Attributes[attributeSessionDuration]; len(values) > 0 {
+		seconds, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid SessionDuration %q", values[0])
+		}
+
+		a.SessionDuration = time.Duration(seconds) * time.Second
+	}
+
+	for _, value := range a.Attributes[attributeRole] {
+		role, err := parseAssertionRole(value)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Roles = append(a.Roles, role)
+	}
+
+	return a, nil
+}
+
+func parseInstant(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseAssertionRole parses a "role,principal" value of the Role attribute.
+// AWS accepts the pair in either order.
+func parseAssertionRole(value string) (role AssertionRole, err error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return role, errors.Errorf("invalid Role attribute value %q", value)
+	}
+
+	for _, part := range parts {
+		parsed, err := arn.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return role, errors.Wrapf(err, "invalid Role attribute value %q", value)
+		}
+
+		if strings.HasPrefix(parsed.Resource, "saml-provider/") {
+			role.PrincipalARN = parsed
+		} else {
+			role.RoleARN = parsed
+		}
+	}
+
+	if role.RoleARN.Resource == "" || role.PrincipalARN.Resource == "" {
+		return role, errors.Errorf("invalid Role attribute value %q", value)
+	}
+
+	return role, nil
+}
+
+// PrincipalARN returns the ARN of the SAML provider paired with roleARN. It
+// returns an error wrapping ErrRoleNotGranted when the assertion does not
+// grant the role.
+func (a *Assertion) PrincipalARN(roleARN string) (string, error) {
+	for _, r := range a.Roles {
+		if r.RoleARN.String() == roleARN {
+			return r.PrincipalARN.String(), nil
+		}
+	}
+
+	return "", errors.Wrapf(ErrRoleNotGranted, "%s is not granted to %s", roleARN, a.Subject)
+}
+
+// Accounts groups the roles of the assertion by AWS account, in the order
+// they are asserted. The account names are "Account: <id>".
+func (a *Assertion) Accounts() Accounts {
+	accounts := Accounts{}
+	index := map[string]int{}
+
+	for _, r := range a.Roles {
+		i, ok := index[r.RoleARN.AccountID]
+		if !ok {
+			i = len(accounts)
+			index[r.RoleARN.AccountID] = i
+			accounts = append(accounts, Account{
+				Name: "Account: " + r.RoleARN.AccountID,
+				ID:   r.RoleARN.AccountID,
+			})
+		}
+
+		roleARN, principalARN := r.RoleARN, r.PrincipalARN
+
+		accounts[i].Roles = append(accounts[i].Roles, Role{
+			Name:         roleName(roleARN),
+			ARN:          &roleARN,
+			AccountID:    roleARN.AccountID,
+			PrincipalARN: &principalARN,
+		})
+	}
+
+	return accounts
+}
@@ -0,0 +1,120 @@
+package saml
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func loadSAMLResponse(t *testing.T, name string) string {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestParseSAMLResponse(t *testing.T) {
+	a, err := ParseSAMLResponse(loadSAMLResponse(t, "saml_response.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Issuer != "https://accounts.google.com/o/saml2?idpid=C01abc2de" {
+		t.Errorf("unexpected issuer %q", a.Issuer)
+	}
+
+	if a.Destination != "https://signin.aws.amazon.com/saml" || a.Recipient != a.Destination {
+		t.Errorf("unexpected destination %q, recipient %q", a.Destination, a.Recipient)
+	}
+
+	if a.Subject != "jane@example.com" || a.RoleSessionName != "jane@example.com" {
+		t.Errorf("unexpected subject %q, role session name %q", a.Subject, a.RoleSessionName)
+	}
+
+	if len(a.Audience) != 1 || a.Audience[0] != "urn:amazon:webservices" {
+		t.Errorf("unexpected audience %v", a.Audience)
+	}
+
+	if expected := time.Date(2019, 5, 1, 10, 5, 0, 0, time.UTC); !a.NotOnOrAfter.Equal(expected) {
+		t.Errorf("expected NotOnOrAfter %s, got %s", expected, a.NotOnOrAfter)
+	}
+
+	if a.SourceIdentity != "jane@example.com" || a.PrincipalTags["CostCenter"] != "1234" || len(a.TransitiveTagKeys) != 1 {
+		t.Errorf("unexpected session attributes %q, %v, %v", a.SourceIdentity, a.PrincipalTags, a.TransitiveTagKeys)
+	}
+
+	if a.SessionDuration != 8*time.Hour {
+		t.Errorf("expected session duration 8h, got %s", a.SessionDuration)
+	}
+
+	expected := [][2]string{
+		{"arn:aws:iam::123456789012:role/Admin", "arn:aws:iam::123456789012:saml-provider/GoogleApps"},
+		{"arn:aws:iam::210987654321:role/ops/Deploy", "arn:aws:iam::210987654321:saml-provider/Google"},
+		{"arn:aws:iam::123456789012:role/ReadOnly", "arn:aws:iam::123456789012:saml-provider/GoogleApps"},
+	}
+
+	if len(a.Roles) != len(expected) {
+		t.Fatalf("expected %d roles, got %d", len(expected), len(a.Roles))
+	}
+
+	for i, role := range a.Roles {
+		if role.RoleARN.String() != expected[i][0] || role.PrincipalARN.String() != expected[i][1] {
+			t.Errorf("unexpected role %s, %s", role.RoleARN, role.PrincipalARN)
+		}
+	}
+
+	accounts := a.Accounts()
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %+v", accounts)
+	}
+
+	if accounts[0].Name != "Account: 123456789012" || len(accounts[0].Roles) != 2 {
+		t.Errorf("unexpected account %+v", accounts[0])
+	}
+
+	if accounts[1].Roles[0].Name != "Deploy" {
+		t.Errorf("expected role name Deploy, got %q", accounts[1].Roles[0].Name)
+	}
+}
+
+func TestParseSAMLResponseInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response string
+	}{
+		{"not base64", "!"},
+		{"not XML", base64.StdEncoding.EncodeToString([]byte("<html>"))},
+		{"no assertion", base64.StdEncoding.EncodeToString([]byte(`<Response xmlns="urn:oasis:names:tc:SAML:2.0:protocol"/>`))},
+		{"failed", base64.StdEncoding.EncodeToString([]byte(`<Response xmlns="urn:oasis:names:tc:SAML:2.0:protocol"><Status><StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Requester"/></Status></Response>`))},
+	} {
+		if _, err := ParseSAMLResponse(tc.response); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestAssertionPrincipalARN(t *testing.T) {
+	a, err := ParseSAMLResponse(loadSAMLResponse(t, "saml_response.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := a.PrincipalARN("arn:aws:iam::210987654321:role/ops/Deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if principal != "arn:aws:iam::210987654321:saml-provider/Google" {
+		t.Errorf("unexpected principal %s", principal)
+	}
+
+	if _, err = a.PrincipalARN("arn:aws:iam::210987654321:role/Admin"); !errors.Is(err, ErrRoleNotGranted) {
+		t.Errorf("expected %v, got %v", ErrRoleNotGranted, err)
+	}
+}
@@ -0,0 +1,120 @@
+package saml
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// AWSMFACode is the code of an AWS MFA device, asked for with Prompter.PIN
+// when a chained role requires MFA. It is not a Google challenge and cannot
+// be part of a challenge preference.
+const AWSMFACode ChallengeType = "aws-mfa"
+
+// chainedSessionDuration is the longest session AWS grants to a role
+// assumed with the credentials of another role.
+const chainedSessionDuration = 3600
+
+// ChainedRole is a role assumed with sts:AssumeRole using the credentials of
+// the previous role of the chain.
+type ChainedRole struct {
+	ARN        string
+	ExternalID string
+	// SessionName defaults to the WithRoleSessionName template, or to the
+	// RoleSessionName of the assertion.
+	SessionName string
+	// SerialNumber is the ARN of the MFA device to present when the trust
+	// policy of the role requires MFA.
+	SerialNumber string
+	// TokenCode is the MFA code. It is asked for with the Prompter when
+	// SerialNumber is set and TokenCode is empty.
+	TokenCode string
+	// Duration is the duration of the session in seconds. It defaults to one
+	// hour, the longest AWS allows for a chained role.
+	Duration int64
+}
+
+// RetrieveChainedCredentials gets the STS credentials of the role identified
+// by roleARN, then assumes each role of chain in turn with the credentials of
+// the previous one, and returns the credentials of the last role.
+func (g *GSuite) RetrieveChainedCredentials(roleARN string, duration int64, chain ...ChainedRole) (*sts.Credentials, error) {
+	return g.RetrieveChainedCredentialsContext(context.Background(), roleARN, duration, chain...)
+}
+
+// RetrieveChainedCredentialsContext is like RetrieveChainedCredentials, but
+// cancelling ctx aborts the requests to STS and the MFA prompts.
+func (g *GSuite) RetrieveChainedCredentialsContext(ctx context.Context, roleARN string, duration int64, chain ...ChainedRole) (*sts.Credentials, error) {
+	o, err := g.RetrieveRoleCredentialsContext(ctx, roleARN, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := o.Credentials
+
+	for _, role := range chain {
+		if creds, err = g.assumeRole(ctx, creds, role); err != nil {
+			return nil, errors.Wrapf(err, "failed to assume %s", role.ARN)
+		}
+	}
+
+	return creds, nil
+}
+
+// assumeRole assumes role with the credentials creds.
+func (g *GSuite) assumeRole(ctx context.Context, creds *sts.Credentials, role ChainedRole) (*sts.Credentials, error) {
+	if err := g.checkPartition(role.ARN); err != nil {
+		return nil, err
+	}
+
+	svc, err := g.newSTSClient(credentials.NewStaticCredentials(
+		aws.StringValue(creds.AccessKeyId),
+		aws.StringValue(creds.SecretAccessKey),
+		aws.StringValue(creds.SessionToken),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(role.ARN),
+		DurationSeconds: aws.Int64(role.Duration),
+	}
+
+	if role.SessionName != "" {
+		input.RoleSessionName = aws.String(role.SessionName)
+	}
+
+	if err = g.applySession(input); err != nil {
+		return nil, err
+	}
+
+	if role.Duration == 0 {
+		input.DurationSeconds = aws.Int64(chainedSessionDuration)
+	}
+
+	if role.ExternalID != "" {
+		input.ExternalId = aws.String(role.ExternalID)
+	}
+
+	if role.SerialNumber != "" {
+		code := role.TokenCode
+		if code == "" {
+			if code, err = g.prompter.PIN(ctx, AWSMFACode); err != nil {
+				return nil, err
+			}
+		}
+
+		input.SerialNumber = aws.String(role.SerialNumber)
+		input.TokenCode = aws.String(code)
+	}
+
+	o, err := svc.AssumeRoleWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.Credentials, nil
+}
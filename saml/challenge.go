@@ -0,0 +1,548 @@
+package saml
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// ChallengeType identifies the kind of code asked for with Prompter.PIN: one
+// of the second factors offered by Google listed below, or AWSMFACode.
+type ChallengeType string
+
+const (
+	// ChallengeTOTP is a code from an authenticator app.
+	ChallengeTOTP ChallengeType = "totp"
+	// ChallengePrompt is the "Tap Yes on your phone" prompt.
+	ChallengePrompt ChallengeType = "prompt"
+	// ChallengeSMS is a verification code sent by text message.
+	ChallengeSMS ChallengeType = "sms"
+	// ChallengeVoice is a verification code read out in a phone call.
+	ChallengeVoice ChallengeType = "voice"
+	// ChallengeBackupCode is one of the printed 8-digit backup codes.
+	ChallengeBackupCode ChallengeType = "backup"
+)
+
+// challengePathTypes maps the path segment of a challenge form action to the
+// challenge type. SMS and voice calls share the same path and are told apart
+// by the send method of the form.
+var challengePathTypes = map[string]ChallengeType{
+	"totp": ChallengeTOTP,
+	"az":   ChallengePrompt,
+	"ipp":  ChallengeSMS,
+	"bc":   ChallengeBackupCode,
+}
+
+// challengeTypeIDs are the values Google expects in the challengeType form
+// field.
+var challengeTypeIDs = map[ChallengeType]string{
+	ChallengeTOTP:       "6",
+	ChallengePrompt:     "39",
+	ChallengeSMS:        "9",
+	ChallengeVoice:      "9",
+	ChallengeBackupCode: "8",
+}
+
+// challengePath matches the form action of a challenge page, e.g.
+// /signin/challenge/totp/2.
+var challengePath = regexp.MustCompile(`/signin/challenge/([a-z]+)/(\d+)`)
+
+// errChallengeRejected is returned by submitChallenge when Google renders the
+// same challenge again.
+var errChallengeRejected = errors.New("challenge rejected")
+
+const (
+	// defaultPromptTimeout is how long to wait for the user to respond to
+	// the phone prompt when the page does not specify the lifetime of the
+	// transaction.
+	defaultPromptTimeout = 2 * time.Minute
+
+	// promptPollInterval is the delay between two polls of the phone prompt
+	// transaction.
+	promptPollInterval = 2 * time.Second
+)
+
+// parseChallenge returns the challenge type and id encoded in a form action.
+func parseChallenge(action string) (t ChallengeType, id string, ok bool) {
+	m := challengePath.FindStringSubmatch(action)
+	if m == nil {
+		return "", "", false
+	}
+
+	t, ok = challengePathTypes[m[1]]
+	if !ok {
+		t = ChallengeType(m[1])
+	}
+
+	return t, m[2], true
+}
+
+// challengeOf returns the type and id of the challenge rendered in doc.
+func challengeOf(doc *goquery.Document) (t ChallengeType, id string, ok bool) {
+	action, err := scrapeChallengeAction(doc)
+	if err != nil {
+		return "", "", false
+	}
+
+	t, id, ok = parseChallenge(action)
+	if ok && t == ChallengeSMS && scrapeSendMethod(doc) == sendMethodVoice {
+		t = ChallengeVoice
+	}
+
+	return t, id, ok
+}
+
+// Challenge is a second factor challenge offered on the "Try another way"
+// page. The challenges supported by the login flow are handed to
+// Prompter.SelectChallenge when no challenge preference is configured.
+type Challenge struct {
+	Type        ChallengeType
+	ID          string
+	Description string
+
+	form *goquery.Selection
+}
+
+func challengeDescriptions(challenges []Challenge) []string {
+	descriptions := make([]string, len(challenges))
+	for i, c := range challenges {
+		descriptions[i] = c.Description
+	}
+
+	return descriptions
+}
+
+// supportedChallenges are the challenge types the login flow can complete.
+var supportedChallenges = []ChallengeType{
+	ChallengeTOTP,
+	ChallengePrompt,
+	ChallengeSMS,
+	ChallengeVoice,
+	ChallengeBackupCode,
+}
+
+func isSupportedChallenge(t ChallengeType) bool {
+	for _, supported := range supportedChallenges {
+		if t == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseChallengePreference parses a comma separated list of challenge types,
+// e.g. "totp,prompt,sms".
+func ParseChallengePreference(s string) (types []ChallengeType, err error) {
+	for _, field := range strings.Split(s, ",") {
+		t := ChallengeType(strings.ToLower(strings.TrimSpace(field)))
+		if t == "" {
+			continue
+		}
+
+		if !isSupportedChallenge(t) {
+			return nil, errors.Errorf("unsupported challenge %q", t)
+		}
+
+		types = append(types, t)
+	}
+
+	return types, nil
+}
+
+// enterChallenge completes the second factor challenge rendered in doc, or
+// the one selected from the "Try another way" page, and returns the resulting
+// page.
+func (g *GSuite) enterChallenge(ctx context.Context, doc *goquery.Document) (next *goquery.Document, err error) {
+	if isChallengeList(doc) {
+		if doc, err = g.selectChallenge(ctx, doc); err != nil {
+			return
+		}
+	} else {
+		t, _, ok := challengeOf(doc)
+		if !ok {
+			return nil, errors.New("could not find challengeId")
+		}
+
+		if !isSupportedChallenge(t) || (len(g.challengePreference) > 0 && t != g.challengePreference[0]) {
+			if doc, err = g.switchChallenge(ctx, doc, t); err != nil {
+				return
+			}
+		}
+	}
+
+	// Google may skip the challenge altogether, e.g. for a trusted device.
+	if isSAMLPage(doc) {
+		return doc, nil
+	}
+
+	t, _, _ := challengeOf(doc)
+
+	switch t {
+	case ChallengeTOTP, ChallengeBackupCode:
+		return g.enterPIN(ctx, doc, t)
+	case ChallengePrompt:
+		return g.enterPrompt(ctx, doc)
+	case ChallengeSMS, ChallengeVoice:
+		if !codeSent(doc) {
+			if doc, err = g.sendCode(ctx, doc, t); err != nil || isSAMLPage(doc) {
+				return doc, err
+			}
+		}
+
+		return g.enterPIN(ctx, doc, t)
+	default:
+		return nil, errors.Errorf("unsupported challenge %q", t)
+	}
+}
+
+// switchChallenge navigates from the challenge t rendered in doc to the "Try
+// another way" page and selects a challenge there.
+func (g *GSuite) switchChallenge(ctx context.Context, doc *goquery.Document, t ChallengeType) (*goquery.Document, error) {
+	skip := doc.Find("form[action*='/signin/selectchallenge/']").First()
+	if skip.Length() == 0 {
+		if !isSupportedChallenge(t) {
+			return nil, errors.Errorf("unsupported challenge %q", t)
+		}
+
+		if len(g.challengePreference) == 0 {
+			return doc, nil
+		}
+
+		for _, preferred := range g.challengePreference {
+			if preferred == t {
+				return doc, nil
+			}
+		}
+
+		return nil, errors.Errorf("none of the preferred challenges %v is offered", g.challengePreference)
+	}
+
+	list, err := g.submitForm(ctx, doc, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.selectChallenge(ctx, list)
+}
+
+// selectChallenge picks one of the challenges listed in doc and returns the
+// page of the selected challenge.
+func (g *GSuite) selectChallenge(ctx context.Context, doc *goquery.Document) (*goquery.Document, error) {
+	c, err := g.chooseChallenge(ctx, scrapeChallenges(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := g.submitForm(ctx, doc, c.form)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSAMLPage(next) {
+		return next, nil
+	}
+
+	if t, _, ok := challengeOf(next); !ok || t != c.Type {
+		return nil, errors.Errorf("failed to switch to the %s challenge", c.Type)
+	}
+
+	return next, nil
+}
+
+// chooseChallenge returns the most preferred of the offered challenges. When
+// no preference is configured, the Prompter selects one.
+func (g *GSuite) chooseChallenge(ctx context.Context, offered []Challenge) (c Challenge, err error) {
+	supported := []Challenge{}
+	for _, c := range offered {
+		if isSupportedChallenge(c.Type) {
+			supported = append(supported, c)
+		}
+	}
+
+	if len(supported) == 0 {
+		return c, errors.New("none of the offered challenges is supported")
+	}
+
+	if len(g.challengePreference) > 0 {
+		for _, preferred := range g.challengePreference {
+			for _, c := range supported {
+				if c.Type == preferred {
+					return c, nil
+				}
+			}
+		}
+
+		return c, errors.Errorf("none of the preferred challenges %v is offered", g.challengePreference)
+	}
+
+	i, err := g.prompter.SelectChallenge(ctx, supported)
+	if err != nil {
+		return
+	}
+
+	if i < 0 || i >= len(supported) {
+		return c, errors.Errorf("invalid challenge selection %d", i)
+	}
+
+	return supported[i], nil
+}
+
+// enterPIN asks for the code of challenge t until it is accepted or
+// maxPINAttempts is reached.
+func (g *GSuite) enterPIN(ctx context.Context, doc *goquery.Document, t ChallengeType) (next *goquery.Document, err error) {
+	for attempt := 1; ; attempt++ {
+		var pin string
+		pin, err = g.prompter.PIN(ctx, t)
+		if err != nil {
+			return
+		}
+
+		next, err = g.submitChallenge(ctx, doc, t, url.Values{"Pin": {pin}})
+		if err != errChallengeRejected {
+			return
+		}
+
+		if t == ChallengeBackupCode && backupCodeUsed(next) {
+			return nil, &LoginError{Err: ErrBackupCodeUsed, Page: pageChallenge.String(), Message: scrapeErrorMessage(next)}
+		}
+
+		if attempt == maxPINAttempts {
+			return nil, &LoginError{Err: ErrWrongPIN, Page: pageChallenge.String(), Message: scrapeErrorMessage(next)}
+		}
+
+		doc = next
+	}
+}
+
+// submitChallenge posts the response to the challenge t rendered in doc and
+// returns the resulting page. It returns the page along with
+// errChallengeRejected when Google renders the same challenge again.
+func (g *GSuite) submitChallenge(ctx context.Context, doc *goquery.Document, t ChallengeType, response url.Values) (next *goquery.Document, err error) {
+	action, err := scrapeChallengeAction(doc)
+	if err != nil {
+		return
+	}
+
+	_, id, _ := parseChallenge(action)
+
+	values := url.Values{}
+	scrapeChallengeValues(doc, values)
+	values["TrustDevice"] = []string{"on"}
+	values["challengeId"] = []string{id}
+	values["challengeType"] = []string{challengeTypeIDs[t]}
+	values["Email"] = []string{g.email}
+	values["Passwd"] = []string{g.passwd}
+	values["checkedDomains"] = []string{"youtube"}
+
+	for name, value := range response {
+		values[name] = value
+	}
+
+	if next, err = g.postForm(ctx, doc, action, values); err != nil {
+		return
+	}
+
+	// Google renders the challenge again when the response is rejected.
+	if again, _, ok := challengeOf(next); ok && again == t {
+		return next, errChallengeRejected
+	}
+
+	return next, nil
+}
+
+// promptTransaction describes the pending phone prompt.
+type promptTransaction struct {
+	id       string
+	apiKey   string
+	gapiURL  string
+	lifetime time.Duration
+}
+
+// enterPrompt waits for the user to respond to the phone prompt rendered in
+// doc and submits the challenge.
+func (g *GSuite) enterPrompt(ctx context.Context, doc *goquery.Document) (next *goquery.Document, err error) {
+	tx, err := scrapePromptTransaction(doc)
+	if err != nil {
+		return
+	}
+
+	timeout := g.promptTimeout
+	if timeout == 0 && tx.lifetime > 0 {
+		timeout = tx.lifetime
+	}
+	if timeout == 0 {
+		timeout = defaultPromptTimeout
+	}
+
+	awaitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err = g.awaitPrompt(awaitCtx, tx); err != nil {
+		return
+	}
+
+	next, err = g.submitChallenge(ctx, doc, ChallengePrompt, nil)
+	if err == errChallengeRejected {
+		return nil, errors.New("the sign-in prompt was denied")
+	}
+
+	return next, err
+}
+
+// awaitPrompt polls the phone prompt transaction until the user responds on
+// their device.
+func (g *GSuite) awaitPrompt(ctx context.Context, tx *promptTransaction) error {
+	endpoint := fmt.Sprintf("%s/cryptauth/v1/authzen/awaittx?alt=json&key=%s", tx.gapiURL, url.QueryEscape(tx.apiKey))
+
+	body, err := json.Marshal(map[string]string{"txId": tx.id})
+	if err != nil {
+		return err
+	}
+
+	for {
+		req, err := g.newRequest(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		r, err := g.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "sign-in prompt was not answered")
+			}
+
+			// The request timeout may be shorter than the long poll.
+			if e, ok := err.(net.Error); !ok || !e.Timeout() {
+				return err
+			}
+
+			continue
+		}
+
+		r.Body.Close()
+
+		switch r.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		default:
+			return errors.Errorf("sign-in prompt failed, status code %d", r.StatusCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "sign-in prompt was not answered")
+		case <-time.After(promptPollInterval):
+		}
+	}
+}
+
+func scrapePromptTransaction(doc *goquery.Document) (*promptTransaction, error) {
+	s := doc.Find("[data-tx-id]").First()
+
+	id, found := s.Attr("data-tx-id")
+	if !found {
+		return nil, errors.New("failed to find sign-in prompt transaction")
+	}
+
+	tx := &promptTransaction{
+		id:      id,
+		gapiURL: "https://content.googleapis.com",
+	}
+
+	tx.apiKey, _ = s.Attr("data-api-key")
+
+	if gapiURL, ok := s.Attr("data-gapi-url"); ok && gapiURL != "" {
+		tx.gapiURL = gapiURL
+	}
+
+	if lifetime, ok := s.Attr("data-tx-lifetime"); ok {
+		if ms, err := strconv.Atoi(lifetime); err == nil {
+			tx.lifetime = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	return tx, nil
+}
+
+const (
+	sendMethodSMS   = "SMS"
+	sendMethodVoice = "VOICE"
+)
+
+func scrapeSendMethod(doc *goquery.Document) string {
+	method, _ := doc.Find("form input[name=SendMethod]").Attr("value")
+
+	return method
+}
+
+// codeSent reports whether doc asks for a verification code that has already
+// been sent.
+func codeSent(doc *goquery.Document) bool {
+	return doc.Find("form input[name=Pin]").Length() > 0
+}
+
+// sendCode asks Google to send the verification code of challenge t by text
+// message or phone call and returns the page asking for the code.
+func (g *GSuite) sendCode(ctx context.Context, doc *goquery.Document, t ChallengeType) (next *goquery.Document, err error) {
+	action, err := scrapeChallengeAction(doc)
+	if err != nil {
+		return
+	}
+
+	_, id, _ := parseChallenge(action)
+
+	method := sendMethodSMS
+	if t == ChallengeVoice {
+		method = sendMethodVoice
+	}
+
+	values := url.Values{}
+	scrapeChallengeValues(doc, values)
+	values["challengeId"] = []string{id}
+	values["challengeType"] = []string{challengeTypeIDs[t]}
+	values["Email"] = []string{g.email}
+	values["SendMethod"] = []string{method}
+
+	if next, err = g.postForm(ctx, doc, action, values); err != nil {
+		return
+	}
+
+	if !isSAMLPage(next) && !codeSent(next) {
+		return nil, errors.Errorf("failed to send %s code", t)
+	}
+
+	return next, nil
+}
+
+// resolveAction returns the absolute URL of a form action found in doc.
+func resolveAction(doc *goquery.Document, action string) (string, error) {
+	base := doc.Url
+	if base == nil {
+		var err error
+		if base, err = url.Parse(defaultAccountsURL); err != nil {
+			return "", err
+		}
+	}
+
+	u, err := base.Parse(action)
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,160 @@
+package saml
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func TestChallengeOf(t *testing.T) {
+	for _, tt := range []struct {
+		fixture string
+		t       ChallengeType
+		id      string
+		sent    bool
+	}{
+		{"challenge_sms_send.html", ChallengeSMS, "4", false},
+		{"challenge_sms.html", ChallengeSMS, "4", true},
+		{"challenge_voice_send.html", ChallengeVoice, "4", false},
+		{"challenge_voice.html", ChallengeVoice, "4", true},
+		{"challenge_backup_used.html", ChallengeBackupCode, "7", true},
+	} {
+		doc := loadFixture(t, tt.fixture)
+
+		ct, id, ok := challengeOf(doc)
+		if !ok {
+			t.Errorf("%s: challenge not found", tt.fixture)
+			continue
+		}
+
+		if ct != tt.t || id != tt.id {
+			t.Errorf("%s: expected challenge %s/%s, got %s/%s", tt.fixture, tt.t, tt.id, ct, id)
+		}
+
+		if sent := codeSent(doc); sent != tt.sent {
+			t.Errorf("%s: expected code sent %v, got %v", tt.fixture, tt.sent, sent)
+		}
+	}
+}
+
+func TestBackupCodeUsed(t *testing.T) {
+	if !backupCodeUsed(loadFixture(t, "challenge_backup_used.html")) {
+		t.Error("expected used backup code to be detected")
+	}
+
+	if backupCodeUsed(loadFixture(t, "challenge_sms.html")) {
+		t.Error("unexpected used backup code")
+	}
+}
+
+func TestScrapeChallenges(t *testing.T) {
+	doc := loadFixture(t, "challenge_list.html")
+
+	if !isChallengeList(doc) {
+		t.Fatal("expected challenge list")
+	}
+
+	expected := []Challenge{
+		{Type: ChallengePrompt, ID: "3", Description: "Get a Google prompt on your phone"},
+		{Type: ChallengeTOTP, ID: "2", Description: "Get a verification code from the Google Authenticator app"},
+		{Type: ChallengeSMS, ID: "4", Description: "Get a verification code at ••• ••• ••42"},
+		{Type: ChallengeVoice, ID: "4", Description: "Call your phone on file ••• ••• ••42"},
+		{Type: ChallengeType("sk"), ID: "5", Description: "Use your security key"},
+		{Type: ChallengeBackupCode, ID: "7", Description: "Enter one of your 8-digit backup codes"},
+	}
+
+	challenges := scrapeChallenges(doc)
+	if len(challenges) != len(expected) {
+		t.Fatalf("expected %d challenges, got %d", len(expected), len(challenges))
+	}
+
+	for i, c := range challenges {
+		if c.Type != expected[i].Type || c.ID != expected[i].ID || c.Description != expected[i].Description {
+			t.Errorf("expected challenge %+v, got %+v", expected[i], c)
+		}
+	}
+}
+
+// challengePicker selects a challenge by type, as a GUI would.
+type challengePicker struct {
+	NonInteractivePrompter
+
+	Type ChallengeType
+}
+
+func (p challengePicker) SelectChallenge(ctx context.Context, challenges []Challenge) (int, error) {
+	for i, c := range challenges {
+		if c.Type == p.Type {
+			return i, nil
+		}
+	}
+
+	return 0, errors.Errorf("the %s challenge is not offered", p.Type)
+}
+
+func TestChooseChallenge(t *testing.T) {
+	offered := scrapeChallenges(loadFixture(t, "challenge_list.html"))
+
+	preference, err := ParseChallengePreference("backup, sms,totp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &GSuite{settings: settings{challengePreference: preference}}
+
+	c, err := g.chooseChallenge(context.Background(), offered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Type != ChallengeBackupCode {
+		t.Errorf("expected the %s challenge, got %s", ChallengeBackupCode, c.Type)
+	}
+
+	// The security key is not supported and is not offered to the Prompter.
+	g = &GSuite{prompter: &ScriptedPrompter{Selections: []int{4}}}
+
+	if c, err = g.chooseChallenge(context.Background(), offered); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Type != ChallengeBackupCode {
+		t.Errorf("expected the %s challenge, got %s", ChallengeBackupCode, c.Type)
+	}
+
+	g = &GSuite{prompter: challengePicker{Type: ChallengeSMS}}
+
+	if c, err = g.chooseChallenge(context.Background(), offered); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Type != ChallengeSMS {
+		t.Errorf("expected the %s challenge, got %s", ChallengeSMS, c.Type)
+	}
+
+	for _, preference := range []string{"totp,sk", "totp," + string(AWSMFACode)} {
+		if _, err = ParseChallengePreference(preference); err == nil {
+			t.Errorf("expected unsupported challenge in %s to be rejected", preference)
+		}
+	}
+}
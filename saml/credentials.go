@@ -0,0 +1,348 @@
+package saml
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+const (
+	// lockTimeout is how long to wait for another process to release the
+	// lock of a file.
+	lockTimeout = 10 * time.Second
+	// lockRetryInterval is the delay between two attempts to take a lock.
+	lockRetryInterval = 50 * time.Millisecond
+
+	// credentialsPerm are the widest permissions of the files holding
+	// credentials: only the user may read them.
+	credentialsPerm os.FileMode = 0600
+	// configPerm are the widest permissions of the config file, which holds
+	// no secrets.
+	configPerm os.FileMode = 0644
+
+	// defaultRefreshWindow is how long before their expiration saved
+	// credentials are renewed.
+	defaultRefreshWindow = 5 * time.Minute
+)
+
+// credentialsExpiration is the key of the credentials file that holds the
+// expiration of the session token, as used by other AWS login tools.
+const credentialsExpiration = "x_security_token_expires"
+
+// awsFile returns the path of the AWS CLI file name: the path set by an
+// option, else the path in the environment variable env, else ~/.aws/name.
+func awsFile(path, env, name string) (string, error) {
+	if path == "" {
+		path = os.Getenv(env)
+	}
+
+	if path == "" {
+		path = filepath.Join("~", ".aws", name)
+	}
+
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, path[1:]), nil
+}
+
+// credentialsFile returns the path of the shared credentials file.
+func (s *settings) credentialsFile() (string, error) {
+	return awsFile(s.credentialsPath, "AWS_SHARED_CREDENTIALS_FILE", "credentials")
+}
+
+// configFile returns the path of the config file.
+func (s *settings) configFile() (string, error) {
+	return awsFile(s.configPath, "AWS_CONFIG_FILE", "config")
+}
+
+// lockFile takes an exclusive lock on path by locking path.lock with the
+// file locking of the OS, which releases the lock of a process that crashes.
+// The lock file is left in place: removing it would let a process lock a new
+// file while another one still waits on the old one. The returned function
+// releases the lock.
+func lockFile(path string) (unlock func(), err error) {
+	lock := path + ".lock"
+
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock %s", path)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+
+			return nil, errors.Wrapf(err, "failed to lock %s", path)
+		}
+
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+
+			return nil, errors.Errorf("timed out waiting for the lock %s", lock)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// writeFileAtomic replaces path with data by renaming a temporary file, so
+// that readers never see a partially written file. When path is a symlink,
+// e.g. set up by a dotfile manager, its target is replaced instead. The
+// permissions of an existing file are kept, new files are only readable by
+// the user. The permissions are restricted to perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	mode &= perm
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err = f.Chmod(mode); err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// updateINIFile applies update to the INI file at path while holding its
+// lock. The permissions of the file are restricted to perm. When backup is
+// true, the previous content is kept in path.bak.
+func updateINIFile(path string, perm os.FileMode, backup bool, update func(*iniFile)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if backup && err == nil {
+		if err = writeFileAtomic(path+".bak", data, perm); err != nil {
+			return errors.Wrap(err, "failed to back up "+path)
+		}
+	}
+
+	f := parseINI(data)
+	update(f)
+
+	return writeFileAtomic(path, f.bytes(), perm)
+}
+
+// writeCredentials sets the credentials c of profile in the shared
+// credentials file at path.
+func writeCredentials(path, profile string, c *sts.Credentials, backup bool) error {
+	if profile == "" {
+		profile = "default"
+	}
+
+	return updateINIFile(path, credentialsPerm, backup, func(f *iniFile) {
+		f.set(profile, "aws_access_key_id", aws.StringValue(c.AccessKeyId))
+		f.set(profile, "aws_secret_access_key", aws.StringValue(c.SecretAccessKey))
+		f.set(profile, "aws_session_token", aws.StringValue(c.SessionToken))
+
+		if c.Expiration != nil {
+			f.set(profile, credentialsExpiration, c.Expiration.UTC().Format(time.RFC3339))
+		}
+	})
+}
+
+// readINIFile parses the file at path. A missing file is read as empty.
+func readINIFile(path string) (*iniFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return parseINI(data), nil
+}
+
+// readCredentials returns the credentials of profile in the shared
+// credentials file at path, or nil when there are none.
+func readCredentials(path, profile string) (*sts.Credentials, error) {
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := readINIFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := f.get(profile, "aws_access_key_id")
+	if !ok {
+		return nil, nil
+	}
+
+	secret, _ := f.get(profile, "aws_secret_access_key")
+	token, _ := f.get(profile, "aws_session_token")
+
+	c := &sts.Credentials{
+		AccessKeyId:     aws.String(id),
+		SecretAccessKey: aws.String(secret),
+		SessionToken:    aws.String(token),
+	}
+
+	if expiration, ok := f.get(profile, credentialsExpiration); ok {
+		t, err := time.Parse(time.RFC3339, expiration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s of profile %s", credentialsExpiration, profile)
+		}
+
+		c.Expiration = &t
+	}
+
+	return c, nil
+}
+
+// CredentialsValid reports whether c are valid for longer than window. The
+// credentials are considered expired when their expiration is unknown.
+func CredentialsValid(c *sts.Credentials, window time.Duration) bool {
+	return c != nil && c.Expiration != nil && time.Until(*c.Expiration) > window
+}
+
+// The keys of the config file that describe the credentials of a profile.
+// The AWS CLI and SDKs ignore them.
+const (
+	configRoleARN    = "gsuite_role_arn"
+	configAccountID  = "gsuite_account_id"
+	configExpiration = "gsuite_expiration"
+)
+
+// Profile describes an AWS CLI profile written with credentials.
+type Profile struct {
+	// Name defaults to "default".
+	Name string
+	// Region and Output are written to the config file when set.
+	Region string
+	Output string
+	// RoleARN and AccountID are written to the config file when set, to
+	// document where the credentials come from. AccountID defaults to the
+	// account of RoleARN.
+	RoleARN   string
+	AccountID string
+}
+
+// configSection returns the section of profile in the config file.
+func configSection(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+
+	return "profile " + profile
+}
+
+// writeConfig updates the section of the profile p in the config file at
+// path with the settings of p and the expiration of c.
+func writeConfig(path string, p Profile, c *sts.Credentials, backup bool) error {
+	return updateINIFile(path, configPerm, backup, func(f *iniFile) {
+		setProfile(f, p)
+
+		if c.Expiration != nil {
+			f.set(configSection(p.Name), configExpiration, c.Expiration.UTC().Format(time.RFC3339))
+		}
+	})
+}
+
+// setProfile sets the settings of p in the config file f.
+func setProfile(f *iniFile, p Profile) {
+	section := configSection(p.Name)
+
+	accountID := p.AccountID
+	if accountID == "" && p.RoleARN != "" {
+		if parsed, err := arn.Parse(p.RoleARN); err == nil {
+			accountID = parsed.AccountID
+		}
+	}
+
+	for _, kv := range [][2]string{
+		{"region", p.Region},
+		{"output", p.Output},
+		{configRoleARN, p.RoleARN},
+		{configAccountID, accountID},
+	} {
+		if kv[1] != "" {
+			f.set(section, kv[0], kv[1])
+		}
+	}
+}
+
+// readConfig returns the settings of profile in the config file at path.
+func readConfig(path, profile string) (Profile, error) {
+	p := Profile{Name: profile}
+
+	f, err := readINIFile(path)
+	if err != nil {
+		return p, err
+	}
+
+	section := configSection(profile)
+
+	p.Region, _ = f.get(section, "region")
+	p.Output, _ = f.get(section, "output")
+	p.RoleARN, _ = f.get(section, configRoleARN)
+	p.AccountID, _ = f.get(section, configAccountID)
+
+	return p, nil
+}
@@ -0,0 +1,379 @@
+package saml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const existingCredentials = `# Managed by hand, do not remove.
+[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret ; inline comment
+
+[work]
+aws_access_key_id=AKIAOLD
+aws_secret_access_key=old-secret
+aws_session_token=old-token
+region = eu-west-1
+
+; trailing comment
+`
+
+func testCredentials(id string) *sts.Credentials {
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(id),
+		SecretAccessKey: aws.String(id + "-secret"),
+		SessionToken:    aws.String(id + "-token"),
+	}
+}
+
+func TestWriteCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+
+	if err = ioutil.WriteFile(path, []byte(existingCredentials), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writeCredentials(path, "work", testCredentials("AKIANEW"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writeCredentials(path, "new", testCredentials("AKIANEWER"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# Managed by hand, do not remove.
+[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret ; inline comment
+
+[work]
+aws_access_key_id = AKIANEW
+aws_secret_access_key = AKIANEW-secret
+aws_session_token = AKIANEW-token
+region = eu-west-1
+
+; trailing comment
+
+[new]
+aws_access_key_id = AKIANEWER
+aws_secret_access_key = AKIANEWER-secret
+aws_session_token = AKIANEWER-token
+`
+
+	if string(data) != expected {
+		t.Errorf("unexpected credentials file:\n%s", data)
+	}
+
+	backup, err := ioutil.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(backup) != existingCredentials {
+		t.Errorf("unexpected backup:\n%s", backup)
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("expected the lock to be released, got %v", err)
+	}
+
+	unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("expected the permissions to be restricted to 0600, got %s", info.Mode())
+	}
+
+	if info, err = os.Stat(path + ".bak"); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+		t.Errorf("expected the backup to be restricted to 0600, got %v, %v", info, err)
+	}
+}
+
+func TestWriteCredentialsConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".aws", "credentials")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if err := writeCredentials(path, fmt.Sprintf("profile%d", i), testCredentials(fmt.Sprintf("AKIA%d", i)), false); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if !strings.Contains(string(data), fmt.Sprintf("[profile%d]\naws_access_key_id = AKIA%d\n", i, i)) {
+			t.Errorf("profile%d is missing:\n%s", i, data)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("expected a new file to be created with 0600, got %s", info.Mode())
+	}
+}
+
+func TestAWSFile(t *testing.T) {
+	env := "GSUITE_TEST_AWS_FILE"
+	defer os.Unsetenv(env)
+
+	usr, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		option   string
+		env      string
+		expected string
+	}{
+		{"", "", filepath.Join(usr.HomeDir, ".aws", "credentials")},
+		{"", "/etc/aws/credentials", "/etc/aws/credentials"},
+		{"", "~/aws/credentials", filepath.Join(usr.HomeDir, "aws", "credentials")},
+		{"/tmp/credentials", "/etc/aws/credentials", "/tmp/credentials"},
+	} {
+		os.Setenv(env, tc.env)
+
+		path, err := awsFile(tc.option, env, "credentials")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, path)
+		}
+	}
+}
+
+func TestSaveProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "config")
+
+	if err = ioutil.WriteFile(config, []byte("[default]\nregion = us-east-1\n\n[profile work]\noutput = text\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &GSuite{settings: settings{credentialsPath: filepath.Join(dir, "credentials"), configPath: config}}
+
+	c := testCredentials("AKIAWORK")
+	c.Expiration = aws.Time(time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	if err = g.SaveProfile(Profile{Name: "work", Region: "eu-west-1", RoleARN: "arn:aws:iam::123456789012:role/Admin"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.SaveCredentials(testCredentials("AKIADEFAULT"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[default]
+region = us-east-1
+
+[profile work]
+output = text
+region = eu-west-1
+gsuite_role_arn = arn:aws:iam::123456789012:role/Admin
+gsuite_account_id = 123456789012
+gsuite_expiration = 2019-05-01T12:00:00Z
+`
+
+	if string(data) != expected {
+		t.Errorf("unexpected config file:\n%s", data)
+	}
+
+	data, err = ioutil.ReadFile(g.credentialsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "[work]\naws_access_key_id = AKIAWORK\n") || !strings.Contains(string(data), "[default]\naws_access_key_id = AKIADEFAULT\n") {
+		t.Errorf("unexpected credentials file:\n%s", data)
+	}
+
+	profile, err := g.LoadProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (Profile{Name: "work", Region: "eu-west-1", Output: "text", RoleARN: "arn:aws:iam::123456789012:role/Admin", AccountID: "123456789012"}); profile != expected {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+}
+
+func TestCachedCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+
+	if err = ioutil.WriteFile(path, []byte(existingCredentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := testCredentials("AKIAFRESH")
+	fresh.Expiration = aws.Time(time.Now().Add(time.Hour).Truncate(time.Second).UTC())
+
+	stale := testCredentials("AKIASTALE")
+	stale.Expiration = aws.Time(time.Now().Add(2 * time.Minute).Truncate(time.Second).UTC())
+
+	for profile, c := range map[string]*sts.Credentials{"fresh": fresh, "stale": stale} {
+		if err = writeCredentials(path, profile, c, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := fmt.Sprintf("%s = %s\n", credentialsExpiration, fresh.Expiration.Format(time.RFC3339)); !strings.Contains(string(data), expected) {
+		t.Errorf("expected %q in credentials file:\n%s", expected, data)
+	}
+
+	g := &GSuite{settings: settings{credentialsPath: path, refreshWindow: defaultRefreshWindow}}
+
+	for _, tt := range []struct {
+		profile  string
+		expected string
+	}{
+		{profile: "fresh", expected: "AKIAFRESH"},
+		{profile: "stale"},
+		{profile: "work"},
+		{profile: "missing"},
+	} {
+		c, err := g.CachedCredentials(tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case tt.expected == "" && c != nil:
+			t.Errorf("%s: expected no credentials, got %s", tt.profile, aws.StringValue(c.AccessKeyId))
+		case tt.expected != "" && (c == nil || aws.StringValue(c.AccessKeyId) != tt.expected):
+			t.Errorf("%s: expected credentials %s, got %v", tt.profile, tt.expected, c)
+		case c != nil && !c.Expiration.Equal(*fresh.Expiration):
+			t.Errorf("%s: expected expiration %s, got %s", tt.profile, fresh.Expiration, c.Expiration)
+		}
+	}
+
+	g.refreshWindow = 0
+
+	if c, err := g.CachedCredentials("stale"); err != nil || c == nil {
+		t.Errorf("expected stale credentials outside of an empty window, got %v, %v", c, err)
+	}
+}
+
+func TestWriteCredentialsSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "dotfiles", "credentials")
+	path := filepath.Join(dir, "aws", "credentials")
+
+	for _, d := range []string{filepath.Dir(target), filepath.Dir(path)} {
+		if err = os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = ioutil.WriteFile(target, []byte(existingCredentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writeCredentials(path, "work", testCredentials("AKIANEW"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected the symlink to be kept, got %v, %v", info, err)
+	}
+
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "aws_access_key_id = AKIANEW") {
+		t.Errorf("expected the target of the symlink to be updated:\n%s", data)
+	}
+}
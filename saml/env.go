@@ -0,0 +1,71 @@
+package saml
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// credentialsEnvKeys are the environment variables that select or carry AWS
+// credentials, and that would otherwise shadow the ones set by
+// CredentialsEnv.
+var credentialsEnvKeys = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_SESSION_EXPIRATION",
+	"AWS_CREDENTIAL_EXPIRATION",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+}
+
+// CredentialsEnv returns environ with the credentials c, and region when set,
+// exported in the variables read by the AWS SDKs and CLI. The expiration of
+// the credentials is exported as AWS_SESSION_EXPIRATION and
+// AWS_CREDENTIAL_EXPIRATION. Variables of environ that select a profile or
+// other credentials are removed.
+func CredentialsEnv(environ []string, c *sts.Credentials, region string) []string {
+	drop := map[string]bool{}
+	for _, key := range credentialsEnvKeys {
+		drop[key] = true
+	}
+
+	if region != "" {
+		drop["AWS_REGION"] = true
+		drop["AWS_DEFAULT_REGION"] = true
+	}
+
+	env := make([]string, 0, len(environ)+len(credentialsEnvKeys))
+
+	for _, kv := range environ {
+		key := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			key = kv[:i]
+		}
+
+		if !drop[key] {
+			env = append(env, kv)
+		}
+	}
+
+	env = append(env,
+		"AWS_ACCESS_KEY_ID="+aws.StringValue(c.AccessKeyId),
+		"AWS_SECRET_ACCESS_KEY="+aws.StringValue(c.SecretAccessKey),
+		"AWS_SESSION_TOKEN="+aws.StringValue(c.SessionToken),
+	)
+
+	if c.Expiration != nil {
+		expiration := c.Expiration.UTC().Format(time.RFC3339)
+
+		env = append(env, "AWS_SESSION_EXPIRATION="+expiration, "AWS_CREDENTIAL_EXPIRATION="+expiration)
+	}
+
+	if region != "" {
+		env = append(env, "AWS_REGION="+region, "AWS_DEFAULT_REGION="+region)
+	}
+
+	return env
+}
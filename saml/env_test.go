@@ -0,0 +1,37 @@
+package saml
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestCredentialsEnv(t *testing.T) {
+	c := testCredentials("AKIAENV")
+	c.Expiration = aws.Time(time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	environ := []string{"HOME=/home/jane", "AWS_PROFILE=prod", "AWS_ACCESS_KEY_ID=AKIAOLD", "AWS_REGION=us-east-1", "PATH=/bin"}
+
+	expected := []string{
+		"HOME=/home/jane",
+		"PATH=/bin",
+		"AWS_ACCESS_KEY_ID=AKIAENV",
+		"AWS_SECRET_ACCESS_KEY=AKIAENV-secret",
+		"AWS_SESSION_TOKEN=AKIAENV-token",
+		"AWS_SESSION_EXPIRATION=2019-05-01T12:00:00Z",
+		"AWS_CREDENTIAL_EXPIRATION=2019-05-01T12:00:00Z",
+		"AWS_REGION=eu-west-1",
+		"AWS_DEFAULT_REGION=eu-west-1",
+	}
+
+	if env := CredentialsEnv(environ, c, "eu-west-1"); !reflect.DeepEqual(env, expected) {
+		t.Errorf("unexpected environment %q", env)
+	}
+
+	// Without a region, the region of the environment is kept.
+	if env := CredentialsEnv(environ, c, ""); env[1] != "AWS_REGION=us-east-1" {
+		t.Errorf("unexpected environment %q", env)
+	}
+}
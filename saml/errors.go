@@ -0,0 +1,180 @@
+package saml
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrWrongPassword is returned when Google rejects the password.
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrWrongPIN is returned when Google keeps rejecting the code of a
+	// second factor challenge.
+	ErrWrongPIN = errors.New("wrong verification code")
+	// ErrBackupCodeUsed is returned when Google rejects a backup code because
+	// it has already been used.
+	ErrBackupCodeUsed = errors.New("backup code has already been used")
+	// ErrAccountDisabled is returned when the account is disabled or
+	// suspended.
+	ErrAccountDisabled = errors.New("account disabled")
+	// ErrTooManyAttempts is returned when Google blocks the login after too
+	// many failed attempts.
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+	// ErrCaptchaRequired is returned when Google asks for a CAPTCHA that the
+	// Prompter cannot solve.
+	ErrCaptchaRequired = errors.New("CAPTCHA required")
+	// ErrUnknownPage is returned when Google renders a page the login flow
+	// does not recognise.
+	ErrUnknownPage = errors.New("unknown page")
+	// ErrSAMLNotConfigured is returned when the SAML app is not configured
+	// for the user or does not exist.
+	ErrSAMLNotConfigured = errors.New("SAML app not configured")
+
+	// ErrInvalidSignature is returned when the signature of the SAML response
+	// cannot be verified with the IdP certificates.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrAssertionNotYetValid is returned when the assertion is used before
+	// its NotBefore condition.
+	ErrAssertionNotYetValid = errors.New("assertion not yet valid")
+	// ErrAssertionExpired is returned when the assertion is used on or after
+	// its NotOnOrAfter condition.
+	ErrAssertionExpired = errors.New("assertion expired")
+	// ErrAudienceMismatch is returned when the assertion is not meant for the
+	// expected audience.
+	ErrAudienceMismatch = errors.New("audience mismatch")
+	// ErrDestinationMismatch is returned when the assertion is not meant to be
+	// posted to the expected URL.
+	ErrDestinationMismatch = errors.New("destination mismatch")
+	// ErrIssuerMismatch is returned when the assertion is not issued by the
+	// expected IdP.
+	ErrIssuerMismatch = errors.New("issuer mismatch")
+
+	// ErrRoleNotGranted is returned when credentials are requested for a
+	// role the assertion does not grant.
+	ErrRoleNotGranted = errors.New("role not granted")
+	// ErrNoAssertion is returned when credentials are requested before a
+	// successful login.
+	ErrNoAssertion = errors.New("no SAML assertion, login first")
+	// ErrPartitionMismatch is returned when a role is not in the configured
+	// AWS partition.
+	ErrPartitionMismatch = errors.New("partition mismatch")
+)
+
+// LoginError describes a login rejected by Google. Err is one of the
+// sentinel errors of this package, or nil when the reason is not recognised,
+// and Message is the message rendered by Google.
+type LoginError struct {
+	Err     error
+	Page    string
+	Message string
+}
+
+func (e *LoginError) Error() string {
+	reason := "login failed"
+	if e.Err != nil {
+		reason = e.Err.Error()
+	}
+
+	if e.Message == "" {
+		return fmt.Sprintf("%s on the %s page", reason, e.Page)
+	}
+
+	return fmt.Sprintf("%s on the %s page: %s", reason, e.Page, e.Message)
+}
+
+// Unwrap returns the sentinel error, for use with errors.Is.
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// AssertionError describes a SAML assertion that failed validation. Err is
+// one of the sentinel errors of this package and Detail explains the
+// failure, e.g. the expected and the asserted values.
+type AssertionError struct {
+	Err    error
+	Detail string
+}
+
+func (e *AssertionError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("invalid SAML assertion: %s", e.Err)
+	}
+
+	return fmt.Sprintf("invalid SAML assertion: %s: %s", e.Err, e.Detail)
+}
+
+// Unwrap returns the sentinel error, for use with errors.Is.
+func (e *AssertionError) Unwrap() error {
+	return e.Err
+}
+
+// errorMessages maps fragments of the messages rendered by Google to the
+// sentinel errors.
+var errorMessages = []struct {
+	fragment string
+	err      error
+}{
+	{"wrong password", ErrWrongPassword},
+	{"password was changed", ErrWrongPassword},
+	{"wrong code", ErrWrongPIN},
+	{"code is incorrect", ErrWrongPIN},
+	{"already been used", ErrBackupCodeUsed},
+	{"account has been disabled", ErrAccountDisabled},
+	{"account disabled", ErrAccountDisabled},
+	{"account has been suspended", ErrAccountDisabled},
+	{"too many failed attempts", ErrTooManyAttempts},
+	{"app_not_configured", ErrSAMLNotConfigured},
+	{"not configured for", ErrSAMLNotConfigured},
+	{"invalid_request", ErrSAMLNotConfigured},
+}
+
+// errorFromMessage returns the sentinel error matching a message rendered by
+// Google, or nil.
+func errorFromMessage(message string) error {
+	message = strings.ToLower(strings.Replace(message, "’", "'", -1))
+
+	for _, m := range errorMessages {
+		if strings.Contains(message, m.fragment) {
+			return m.err
+		}
+	}
+
+	return nil
+}
+
+// loginErrorOf returns the *LoginError describing the failure rendered in
+// doc, or nil when doc does not report one.
+func loginErrorOf(doc *goquery.Document, page pageType) *LoginError {
+	var message string
+
+	switch page {
+	case pageError:
+		message = scrapeErrorPage(doc)
+	case pageUnknown:
+		if message = scrapeErrorMessage(doc); message == "" {
+			message = scrapeHeading(doc)
+		}
+	default:
+		message = scrapeErrorMessage(doc)
+	}
+
+	err := errorFromMessage(message)
+
+	switch {
+	case err != nil:
+	case page == pageError:
+	case page == pageUnknown:
+		err = ErrUnknownPage
+	default:
+		return nil
+	}
+
+	return &LoginError{
+		Err:     err,
+		Page:    page.String(),
+		Message: message,
+	}
+}
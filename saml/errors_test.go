@@ -0,0 +1,52 @@
+package saml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+func TestLoginErrorOf(t *testing.T) {
+	for _, tt := range []struct {
+		html string
+		err  error
+	}{
+		{`<form id="gaia_loginform" action="/signin/challenge/sl/password"><input type="password" name="Passwd"><span id="errormsg_0_Passwd">Wrong password. Try again or click Forgot password to reset it.</span></form>`, ErrWrongPassword},
+		{`<form action="/signin/challenge/totp/2"><input name="Pin"><span class="error-msg">Wrong code. Try again.</span></form>`, ErrWrongPIN},
+		{`<h1>Account disabled</h1><p>Your account has been disabled by your administrator.</p>`, ErrAccountDisabled},
+		{`<form id="gaia_loginform" action="/signin/v1/lookup"><input name="Email"><div role="alert">Too many failed attempts. Try again later.</div></form>`, ErrTooManyAttempts},
+		{`<div id="af-error-container"><p><b>403.</b> <ins>That’s an error.</ins></p><p>Error: app_not_configured_for_user</p></div>`, ErrSAMLNotConfigured},
+		{`<h1>Something new</h1>`, ErrUnknownPage},
+	} {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := loginErrorOf(doc, classifyPage(doc))
+		if e == nil {
+			t.Errorf("expected %v, got no error for %s", tt.err, tt.html)
+			continue
+		}
+
+		if !errors.Is(errors.Wrap(e, "login"), tt.err) {
+			t.Errorf("expected %v, got %v", tt.err, e)
+		}
+
+		var loginErr *LoginError
+		if !errors.As(errors.Wrap(e, "login"), &loginErr) || loginErr.Message == "" {
+			t.Errorf("expected *LoginError with a message, got %#v", e)
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<form action="/signin/challenge/totp/2"><input name="Pin"></form>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := loginErrorOf(doc, classifyPage(doc)); e != nil {
+		t.Errorf("unexpected error %v", e)
+	}
+}
@@ -1,11 +1,11 @@
 package saml
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -13,74 +13,72 @@ import (
 )
 
 func (g *GSuite) initSSOString() string {
-	return fmt.Sprintf("https://accounts.google.com/o/saml2/initsso?idpid=%s&spid=%s&forceauthn=false", g.idpid, g.spid)
+	return fmt.Sprintf("%s/o/saml2/initsso?idpid=%s&spid=%s&forceauthn=false", g.accountsURL, g.idpid, g.spid)
 }
 
-// getLoginForm gets the login form.
-func (g *GSuite) getLoginForm() (err error) {
-	r, err := g.Get(g.initSSOString())
+// getLoginForm gets the first page of the Google authn flow.
+func (g *GSuite) getLoginForm(ctx context.Context) (doc *goquery.Document, err error) {
+	req, err := g.newRequest(ctx, http.MethodGet, g.initSSOString(), nil)
 	if err != nil {
 		return
 	}
 
-	defer r.Body.Close()
-
-	if r.StatusCode != http.StatusOK {
-		return errors.Errorf("failed to get login form, status code %d", r.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromResponse(r)
+	r, err := g.Do(req)
 	if err != nil {
 		return
 	}
 
-	if g.currentFormAction, err = scrapeFormAction(doc); err != nil {
-		return
-	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		// Google serves errors such as an unknown SAML app with a 4xx status,
+		// report what the page says when it can be parsed.
+		if doc, err := goquery.NewDocumentFromReader(r.Body); err == nil && classifyPage(doc) == pageError {
+			if lerr := loginErrorOf(doc, pageError); lerr != nil {
+				return nil, lerr
+			}
+		}
 
-	g.currentFormValues = scrapeFormValues(doc)
+		return nil, errors.Errorf("failed to get login form, status code %d", r.StatusCode)
+	}
 
-	return err
+	return goquery.NewDocumentFromResponse(r)
 }
 
-// enterEmail sets the email in the form.
-func (g *GSuite) enterEmail(email string) (err error) {
-	g.email = email
-	g.currentFormValues["Email"] = []string{g.email}
-
-	r, err := g.PostForm(g.currentFormAction, g.currentFormValues)
+// newRequest returns a request carrying the configured User-Agent.
+func (g *GSuite) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	defer r.Body.Close()
-
-	if r.StatusCode != http.StatusOK {
-		return errors.Errorf("email failed, status code %d", r.StatusCode)
+	if g.userAgent != "" {
+		req.Header.Set("User-Agent", g.userAgent)
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(r)
-	if err != nil {
-		return
-	}
+	return req, nil
+}
 
-	if g.currentFormAction, err = scrapeFormAction(doc); err != nil {
-		return
+// post performs an HTTP POST of the URL encoded values.
+func (g *GSuite) post(ctx context.Context, u string, values url.Values) (*http.Response, error) {
+	req, err := g.newRequest(ctx, http.MethodPost, u, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
 	}
 
-	g.currentFormValues = scrapeFormValues(doc)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	return err
+	return g.Do(req)
 }
 
-// enterPassword sets the password in the form.
-func (g *GSuite) enterPassword(passwd string) (err error) {
-	g.passwd = passwd
-
-	g.currentFormValues["Email"] = []string{g.email}
-	g.currentFormValues["Passwd"] = []string{g.passwd}
+// postForm posts values to a form action found in doc and returns the
+// resulting page.
+func (g *GSuite) postForm(ctx context.Context, doc *goquery.Document, action string, values url.Values) (next *goquery.Document, err error) {
+	if action, err = resolveAction(doc, action); err != nil {
+		return
+	}
 
-	r, err := g.PostForm(g.currentFormAction, g.currentFormValues)
+	r, err := g.post(ctx, action, values)
 	if err != nil {
 		return
 	}
@@ -88,144 +86,132 @@ func (g *GSuite) enterPassword(passwd string) (err error) {
 	defer r.Body.Close()
 
 	if r.StatusCode != http.StatusOK {
-		return errors.Errorf("password failed, status code %d", r.StatusCode)
+		return nil, errors.Errorf("failed to post form to %s, status code %d", r.Request.URL.Path, r.StatusCode)
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(r)
-	if err != nil {
-		return
-	}
+	return goquery.NewDocumentFromResponse(r)
+}
 
-	if g.currentFormAction, err = scrapeFormActionF(doc); err != nil {
-		return
+// submitForm posts the hidden inputs of form along with the challenge values
+// of doc and returns the resulting page.
+func (g *GSuite) submitForm(ctx context.Context, doc *goquery.Document, form *goquery.Selection) (*goquery.Document, error) {
+	action, found := form.Attr("action")
+	if !found {
+		return nil, errors.New("failed to find form action")
 	}
 
-	g.currentFormValues = scrapeFormValues(doc)
-
-	url, token, required := captchaRequired(doc)
-	if required {
-		g.enterCAPTCHA(url, token)
-	} else {
-		// TODO(andrewrynhard): How can we scrape these automatically?
-		tl, _ := doc.Find("input[name=TL]").Attr("value")
-		g.currentFormValues["TL"] = []string{tl}
-
-		cont, _ := doc.Find("input[name=continue]").Attr("value")
-		g.currentFormValues["continue"] = []string{cont}
-
-		scc, _ := doc.Find("input[name=scc]").Attr("value")
-		g.currentFormValues["scc"] = []string{scc}
+	values := url.Values{}
+	scrapeChallengeValues(doc, values)
 
-		sarp, _ := doc.Find("input[name=sarp]").Attr("value")
-		g.currentFormValues["sarp"] = []string{sarp}
-
-		gxf, _ := doc.Find("input[name=gxf]").Attr("value")
-		g.currentFormValues["gxf"] = []string{gxf}
+	for name, value := range scrapeHiddenValues(form) {
+		values[name] = value
 	}
 
-	return err
+	return g.postForm(ctx, doc, action, values)
 }
 
-// enterCAPTCHA sets the captcha in the form.
-func (g *GSuite) enterCAPTCHA(url, token string) (err error) {
-	println("CAPTCHA URL: " + url)
-
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter CAPTCHA: ")
-	captcha, _ := reader.ReadString('\n')
-	captcha = strings.Trim(captcha, "\n")
-
-	g.currentFormValues["Email"] = []string{g.email}
-	g.currentFormValues["Passwd"] = []string{g.passwd}
-	g.currentFormValues["logincaptcha"] = []string{captcha}
-	g.currentFormValues["logintoken"] = []string{token}
-	g.currentFormValues["url"] = []string{url}
-
-	r, err := g.PostForm(g.currentFormAction, g.currentFormValues)
+// enterEmail sets the email in the form.
+func (g *GSuite) enterEmail(ctx context.Context, doc *goquery.Document) (*goquery.Document, error) {
+	action, err := scrapeFormAction(doc)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	defer r.Body.Close()
-	doc, err := goquery.NewDocumentFromResponse(r)
+	values := scrapeFormValues(doc)
+	values["Email"] = []string{g.email}
+
+	return g.postForm(ctx, doc, action, values)
+}
+
+// enterPassword sets the password in the form.
+func (g *GSuite) enterPassword(ctx context.Context, doc *goquery.Document) (*goquery.Document, error) {
+	action, err := scrapeFormAction(doc)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	if g.currentFormAction, err = scrapeFormActionF(doc); err != nil {
-		return
-	}
+	values := scrapeFormValues(doc)
+	values["Email"] = []string{g.email}
+	values["Passwd"] = []string{g.passwd}
 
-	g.currentFormValues = scrapeFormValues(doc)
+	return g.postForm(ctx, doc, action, values)
+}
 
-	// TODO(andrewrynhard): How can we scrape these automatically?
-	tl, _ := doc.Find("input[name=TL]").Attr("value")
-	g.currentFormValues["TL"] = []string{tl}
+// enterCAPTCHA sets the captcha in the form.
+func (g *GSuite) enterCAPTCHA(ctx context.Context, doc *goquery.Document) (*goquery.Document, error) {
+	action, err := scrapeFormActionF(doc)
+	if err != nil {
+		return nil, err
+	}
 
-	cont, _ := doc.Find("input[name=continue]").Attr("value")
-	g.currentFormValues["continue"] = []string{cont}
+	url, token, _ := captchaRequired(doc)
 
-	scc, _ := doc.Find("input[name=scc]").Attr("value")
-	g.currentFormValues["scc"] = []string{scc}
+	captcha, err := g.prompter.CAPTCHA(ctx, url)
+	if err != nil {
+		if _, ok := err.(*NonInteractiveError); ok {
+			return nil, &LoginError{Err: ErrCaptchaRequired, Page: pageCAPTCHA.String(), Message: scrapeErrorMessage(doc)}
+		}
 
-	sarp, _ := doc.Find("input[name=sarp]").Attr("value")
-	g.currentFormValues["sarp"] = []string{sarp}
+		return nil, err
+	}
 
-	gxf, _ := doc.Find("input[name=gxf]").Attr("value")
-	g.currentFormValues["gxf"] = []string{gxf}
+	values := scrapeFormValues(doc)
+	values["Email"] = []string{g.email}
+	values["Passwd"] = []string{g.passwd}
+	values["logincaptcha"] = []string{captcha}
+	values["logintoken"] = []string{token}
+	values["url"] = []string{url}
 
-	return err
+	return g.postForm(ctx, doc, action, values)
 }
 
-// enterMFA sets the MFA token in the form.
-func (g *GSuite) enterMFA(m string) (err error) {
-	parts := strings.Split(g.currentFormAction, "totp/")
+// chooseAccount signs in with the email from the account chooser.
+func (g *GSuite) chooseAccount(ctx context.Context, doc *goquery.Document) (*goquery.Document, error) {
+	form := doc.Find("form#account-chooser").First()
 
-	if len(parts) != 2 {
-		return errors.Errorf("could not find challengeId from URL %q", g.currentFormAction)
+	action, found := form.Attr("action")
+	if !found {
+		return nil, errors.New("failed to find form action: #account-chooser")
 	}
-	g.currentFormValues["TrustDevice"] = []string{"on"}
-	g.currentFormValues["challengeId"] = []string{parts[1]}
-	g.currentFormValues["challengeType"] = []string{"6"}
-	g.currentFormValues["Email"] = []string{g.email}
-	g.currentFormValues["Passwd"] = []string{g.passwd}
-	g.currentFormValues["Pin"] = []string{m}
-	g.currentFormValues["checkedDomains"] = []string{"youtube"}
 
-	r, err := g.PostForm("https://accounts.google.com"+g.currentFormAction, g.currentFormValues)
-	if err != nil {
-		return
-	}
+	values := scrapeHiddenValues(form)
+	values["Email"] = []string{g.email}
 
-	defer r.Body.Close()
+	return g.postForm(ctx, doc, action, values)
+}
 
-	if r.StatusCode != http.StatusOK {
-		return errors.Errorf("MFA pin failed, status code %d", r.StatusCode)
+// confirmInterstitial asks the user to confirm an interstitial page such as
+// "Verify it's you" and continues past it.
+func (g *GSuite) confirmInterstitial(ctx context.Context, doc *goquery.Document) (*goquery.Document, error) {
+	message := scrapeHeading(doc)
+	if message == "" {
+		message = "Continue signing in?"
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(r)
+	ok, err := g.prompter.Confirm(ctx, message)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	if g.currentFormAction, err = scrapeFormActionF(doc); err != nil {
-		return
+	if !ok {
+		return nil, errors.Errorf("login aborted at %q", message)
 	}
 
-	g.currentFormValues = scrapeFormValues(doc)
+	return g.submitForm(ctx, doc, doc.Find(interstitialSelector).First())
+}
 
-	if g.samlResponse, err = scrapeSAMLResponse(doc); err != nil {
+// postAWSSaml posts the SAMLResponse to the AWS sign-in page and scrapes the
+// accounts listed by the role picker.
+func (g *GSuite) postAWSSaml(ctx context.Context) (accounts Accounts, err error) {
+	res, err := g.post(ctx, g.signInURL(), url.Values{"SAMLResponse": {g.samlResponse}})
+	if err != nil {
 		return
 	}
 
-	return err
-}
+	defer res.Body.Close()
 
-// postAWSSaml performs an HTTP POST ...
-func (g *GSuite) postAWSSaml() (accounts []Account, err error) {
-	res, err := g.PostForm(g.currentFormAction, url.Values{"SAMLResponse": {g.samlResponse}})
-	if err != nil {
-		return
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to post SAMLResponse to %s, status code %d", res.Request.URL.Host, res.StatusCode)
 	}
 
 	doc, err := goquery.NewDocumentFromResponse(res)
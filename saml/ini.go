@@ -0,0 +1,148 @@
+package saml
+
+import (
+	"bytes"
+	"strings"
+)
+
+// iniFile is a minimal editor of the INI files of the AWS CLI. Unlike a full
+// parse and rewrite, it only touches the keys it sets, so that the comments
+// and the formatting written by other tools are preserved.
+type iniFile struct {
+	lines []string
+}
+
+func parseINI(data []byte) *iniFile {
+	f := &iniFile{}
+
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	if text = strings.TrimSuffix(text, "\n"); text != "" {
+		f.lines = strings.Split(text, "\n")
+	}
+
+	return f
+}
+
+func (f *iniFile) bytes() []byte {
+	var buf bytes.Buffer
+
+	for _, line := range f.lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// sectionName returns the name of the section declared by line.
+func sectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
+
+// keyName returns the key set by line.
+func keyName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == ';' {
+		return "", false
+	}
+
+	i := strings.IndexAny(line, "=:")
+	if i < 0 {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[:i]), true
+}
+
+// section returns the index of the header of section and the index of the
+// line that follows its last key, or -1 when the file has no such section.
+func (f *iniFile) section(section string) (header, end int) {
+	header = -1
+
+	for i, line := range f.lines {
+		name, ok := sectionName(line)
+		if !ok {
+			if _, ok := keyName(line); ok && header >= 0 {
+				end = i + 1
+			}
+
+			continue
+		}
+
+		if header >= 0 {
+			break
+		}
+
+		if name == section {
+			header, end = i, i+1
+		}
+	}
+
+	return header, end
+}
+
+// get returns the value of key in section.
+func (f *iniFile) get(section, key string) (string, bool) {
+	header, end := f.section(section)
+	if header < 0 {
+		return "", false
+	}
+
+	for _, line := range f.lines[header+1 : end] {
+		if name, ok := keyName(line); ok && name == key {
+			line = strings.TrimSpace(line)
+
+			return strings.TrimSpace(line[strings.IndexAny(line, "=:")+1:]), true
+		}
+	}
+
+	return "", false
+}
+
+// set sets key to value in section, adding the section at the end of the
+// file when it does not exist.
+func (f *iniFile) set(section, key, value string) {
+	line := key + " = " + value
+
+	header, end := f.section(section)
+	if header < 0 {
+		if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+			f.lines = append(f.lines, "")
+		}
+
+		f.lines = append(f.lines, "["+section+"]", line)
+
+		return
+	}
+
+	for i := header + 1; i < end; i++ {
+		if name, ok := keyName(f.lines[i]); ok && name == key {
+			f.lines[i] = line
+
+			return
+		}
+	}
+
+	f.lines = append(f.lines[:end], append([]string{line}, f.lines[end:]...)...)
+}
+
+// unset removes key from section.
+func (f *iniFile) unset(section, key string) {
+	header, end := f.section(section)
+	if header < 0 {
+		return
+	}
+
+	for i := header + 1; i < end; i++ {
+		if name, ok := keyName(f.lines[i]); ok && name == key {
+			f.lines = append(f.lines[:i], f.lines[i+1:]...)
+
+			return
+		}
+	}
+}
@@ -1,104 +1,273 @@
 package saml
 
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"net/http"
 	"net/http/cookiejar"
-	"net/url"
-	"os"
-	"os/user"
-	"path/filepath"
-	"strings"
 
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/arn"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
-	"github.com/go-ini/ini"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
 	"golang.org/x/net/publicsuffix"
 )
 
+// defaultAccountsURL is the base URL of the Google accounts service.
+const defaultAccountsURL = "https://accounts.google.com"
+
+// maxLoginSteps is the number of pages the login may go through before it is
+// aborted, which guards against loops in the authn flow.
+const maxLoginSteps = 20
+
+// maxPINAttempts is the number of times the MFA PIN is requested before the
+// login is aborted.
+const maxPINAttempts = 2
+
 // GSuite is ...
 type GSuite struct {
 	*http.Client
-	idpid             string
-	spid              string
-	currentFormAction string
-	currentFormValues url.Values
-	samlResponse      string
-	email             string
-	passwd            string
+	settings
+	prompter     Prompter
+	idpid        string
+	spid         string
+	samlAction   string
+	samlResponse string
+	assertion    *Assertion
+	sts          stsiface.STSAPI
+	email        string
+	passwd       string
 }
 
-// Account represents an AWS account.
-type Account struct {
-	Name  string
-	Roles []Role
-}
+// NewGSuiteSAMLLogin instantiates and returns an *GSuite configured with a
+// cookie jar. Input required during login is requested from prompter. If
+// prompter is nil, the user is prompted on the terminal.
+func NewGSuiteSAMLLogin(idpid, spid string, prompter Prompter, opts ...Option) (g *GSuite, err error) {
+	s := defaultSettings()
+	for _, opt := range opts {
+		if err = opt(&s); err != nil {
+			return nil, err
+		}
+	}
 
-// Role represents and AWS role.
-type Role struct {
-	Name string
-	ARN  *arn.ARN
-}
+	p, err := s.resolvePartition()
+	if err != nil {
+		return
+	}
 
-// NewGSuiteSAMLLogin instantiates and returns an *GSuite configured with a
-// cookie jar.
-func NewGSuiteSAMLLogin(idpid, spid string) (g *GSuite, err error) {
-	options := &cookiejar.Options{
-		PublicSuffixList: publicsuffix.List,
+	if s.partition != "" && s.awsSignInURL == "" {
+		s.awsSignInURL = p.signInURL
 	}
 
-	// This enables cookies, which is a requirement for the Google authn flow.
-	jar, err := cookiejar.New(options)
+	client, err := s.httpClient()
 	if err != nil {
 		return
 	}
 
+	if client.Jar == nil {
+		options := &cookiejar.Options{
+			PublicSuffixList: publicsuffix.List,
+		}
+
+		// This enables cookies, which is a requirement for the Google authn
+		// flow.
+		if client.Jar, err = cookiejar.New(options); err != nil {
+			return
+		}
+	}
+
+	if prompter == nil {
+		prompter = NewDefaultPrompter()
+	}
+
 	g = &GSuite{
-		&http.Client{
-			Jar: jar,
-		},
-		idpid,
-		spid,
-		"",
-		url.Values{},
-		"",
-		"",
-		"",
+		Client:   client,
+		settings: s,
+		prompter: prompter,
+		idpid:    idpid,
+		spid:     spid,
 	}
 
 	return g, err
 }
 
 // Login executes the steps required to login using the Google authn flow.
-func (g *GSuite) Login(e, p string) (accounts []Account, err error) {
-	err = g.getLoginForm()
+// Each page returned by Google is classified and handled until the page
+// carrying the SAMLResponse is reached.
+func (g *GSuite) Login(e, p string) (accounts Accounts, err error) {
+	return g.LoginContext(context.Background(), e, p)
+}
+
+// LoginContext is like Login, but cancelling ctx aborts the HTTP requests and
+// the prompts of the login.
+func (g *GSuite) LoginContext(ctx context.Context, e, p string) (accounts Accounts, err error) {
+	g.email = e
+	g.passwd = p
+
+	doc, err := g.getLoginForm(ctx)
 	if err != nil {
 		return
 	}
-	err = g.enterEmail(e)
-	if err != nil {
+
+	handlers := g.pageHandlers()
+
+	for step := 0; ; step++ {
+		if step == maxLoginSteps {
+			return nil, errors.Errorf("login did not complete after %d steps", maxLoginSteps)
+		}
+
+		page := classifyPage(doc)
+
+		if page == pageSAML {
+			if err = g.acceptSAMLResponse(doc); err != nil {
+				return
+			}
+
+			return g.accounts(ctx), nil
+		}
+
+		if e := loginErrorOf(doc, page); e != nil {
+			return nil, e
+		}
+
+		if doc, err = handlers[page](ctx, doc); err != nil {
+			if _, ok := err.(*LoginError); !ok {
+				err = errors.Wrapf(err, "%s page", page)
+			}
+
+			return nil, err
+		}
+	}
+}
+
+// acceptSAMLResponse stores the SAMLResponse and the URL it has to be posted
+// to.
+func (g *GSuite) acceptSAMLResponse(doc *goquery.Document) (err error) {
+	if g.samlResponse, err = scrapeSAMLResponse(doc); err != nil {
 		return
 	}
-	err = g.enterPassword(p)
+
+	action, err := scrapeSAMLAction(doc)
 	if err != nil {
 		return
 	}
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter PIN: ")
-	pin, _ := reader.ReadString('\n')
-	pin = strings.Trim(pin, "\n")
-	err = g.enterMFA(pin)
-	if err != nil {
+
+	if g.samlAction, err = resolveAction(doc, action); err != nil {
+		return
+	}
+
+	if g.assertion, err = ParseSAMLResponse(g.samlResponse); err != nil {
 		return
 	}
-	return g.postAWSSaml()
+
+	if g.validation == nil {
+		return nil
+	}
+
+	p := *g.validation
+	if p.Destination == "" {
+		p.Destination = g.signInURL()
+	}
+
+	if err = g.assertion.Validate(p); err != nil {
+		// Make sure a rejected assertion cannot be exchanged for credentials.
+		g.samlResponse = ""
+		g.assertion = nil
+	}
+
+	return err
+}
+
+// signInURL returns the URL of the AWS sign-in page the SAMLResponse is
+// posted to.
+func (g *GSuite) signInURL() string {
+	if g.awsSignInURL != "" {
+		return g.awsSignInURL
+	}
+
+	return g.samlAction
+}
+
+// Assertion returns the SAML assertion received by the last successful login.
+func (g *GSuite) Assertion() *Assertion {
+	return g.assertion
+}
+
+// accounts returns the accounts granted by the assertion. Unless disabled,
+// the account names are looked up on the AWS role picker, which is the only
+// place the account aliases are known. The lookup is best effort and the
+// account IDs are used when it fails.
+func (g *GSuite) accounts(ctx context.Context) Accounts {
+	accounts := g.assertion.Accounts()
+
+	if !g.accountNameLookup {
+		return accounts
+	}
+
+	scraped, err := g.postAWSSaml(ctx)
+	if err != nil {
+		return accounts
+	}
+
+	scrapedByID := map[string]Account{}
+
+	for _, account := range scraped {
+		if account.ID != "" {
+			scrapedByID[account.ID] = account
+		}
+	}
+
+	for i, account := range accounts {
+		if found, ok := scrapedByID[account.ID]; ok {
+			accounts[i].Name = found.Name
+			accounts[i].Alias = found.Alias
+		}
+	}
+
+	return accounts
 }
 
-// RetrieveAWSCredentials gets the STS credentials.
+// RetrieveRoleCredentials gets the STS credentials of the role identified by
+// roleARN. The principal ARN is the SAML provider paired with the role in the
+// assertion.
+func (g *GSuite) RetrieveRoleCredentials(roleARN string, duration int64) (*sts.AssumeRoleWithSAMLOutput, error) {
+	return g.RetrieveRoleCredentialsContext(context.Background(), roleARN, duration)
+}
+
+// RetrieveRoleCredentialsContext is like RetrieveRoleCredentials, but
+// cancelling ctx aborts the request to STS.
+func (g *GSuite) RetrieveRoleCredentialsContext(ctx context.Context, roleARN string, duration int64) (*sts.AssumeRoleWithSAMLOutput, error) {
+	return g.RetrieveAWSCredentialsContext(ctx, "", roleARN, duration)
+}
+
+// RetrieveAWSCredentials gets the STS credentials. If principal is empty, it
+// is resolved from the assertion as with RetrieveRoleCredentials.
 func (g *GSuite) RetrieveAWSCredentials(principal, arn string, duration int64) (o *sts.AssumeRoleWithSAMLOutput, err error) {
-	svc := sts.New(session.New())
+	return g.RetrieveAWSCredentialsContext(context.Background(), principal, arn, duration)
+}
+
+// RetrieveAWSCredentialsContext is like RetrieveAWSCredentials, but
+// cancelling ctx aborts the request to STS.
+func (g *GSuite) RetrieveAWSCredentialsContext(ctx context.Context, principal, arn string, duration int64) (o *sts.AssumeRoleWithSAMLOutput, err error) {
+	if g.assertion == nil {
+		return nil, ErrNoAssertion
+	}
+
+	if err = g.checkPartition(arn); err != nil {
+		return
+	}
+
+	if principal == "" {
+		if principal, err = g.assertion.PrincipalARN(arn); err != nil {
+			return
+		}
+	}
+
+	svc, err := g.stsClient()
+	if err != nil {
+		return
+	}
 
 	input := &sts.AssumeRoleWithSAMLInput{
 		DurationSeconds: &duration,
@@ -107,7 +276,7 @@ func (g *GSuite) RetrieveAWSCredentials(principal, arn string, duration int64) (
 		SAMLAssertion:   &g.samlResponse,
 	}
 
-	o, err = svc.AssumeRoleWithSAML(input)
+	o, err = svc.AssumeRoleWithSAMLWithContext(ctx, input)
 	if err != nil {
 		return
 	}
@@ -115,50 +284,83 @@ func (g *GSuite) RetrieveAWSCredentials(principal, arn string, duration int64) (
 	return o, err
 }
 
-// SaveAWSCredentials saves the STS credentials to ~/.aws/credentials.
+// SaveAWSCredentials saves the STS credentials to the profile p. See
+// SaveProfile.
 func (g *GSuite) SaveAWSCredentials(o *sts.AssumeRoleWithSAMLOutput, p string) error {
-	usr, err := user.Current()
-	if err != nil {
-		return err
-	}
-	dir := usr.HomeDir
-	sharedCredentialsFile := filepath.Join(dir, ".aws", "credentials")
-	if err := os.MkdirAll(filepath.Dir(sharedCredentialsFile), 0700); err != nil {
-		return err
-	}
-	if _, err := os.Stat(sharedCredentialsFile); os.IsNotExist(err) {
-		emptyFile, err := os.Create(sharedCredentialsFile)
-		defer emptyFile.Close()
-		if err != nil {
-			return err
+	profile := Profile{Name: p}
+
+	if o.AssumedRoleUser != nil {
+		if parsed, err := arn.Parse(aws.StringValue(o.AssumedRoleUser.Arn)); err == nil {
+			profile.AccountID = parsed.AccountID
 		}
 	}
-	config, err := ini.Load(sharedCredentialsFile)
-	if err != nil {
-		return err
+
+	return g.SaveProfile(profile, o.Credentials)
+}
+
+// SaveCredentials saves the credentials c, e.g. returned by
+// RetrieveChainedCredentials, to the profile p. See SaveProfile.
+func (g *GSuite) SaveCredentials(c *sts.Credentials, p string) error {
+	return g.SaveProfile(Profile{Name: p}, c)
+}
+
+// SaveProfile saves the credentials c to the shared credentials file, and
+// the settings of p along with the expiration of c to the config file. The
+// files are ~/.aws/credentials and ~/.aws/config, unless overridden by
+// AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE or by options. The other
+// profiles and the comments of the files are preserved, and the files are
+// locked and replaced atomically so that concurrent logins do not lose each
+// other's profiles.
+func (g *GSuite) SaveProfile(p Profile, c *sts.Credentials) error {
+	if p.Name == "" {
+		p.Name = "default"
 	}
 
-	iniProfile, err := config.NewSection(p)
+	credentialsPath, err := g.credentialsFile()
 	if err != nil {
 		return err
 	}
-	_, err = iniProfile.NewKey("aws_access_key_id", *o.Credentials.AccessKeyId)
+
+	configPath, err := g.configFile()
 	if err != nil {
 		return err
 	}
-	_, err = iniProfile.NewKey("aws_secret_access_key", *o.Credentials.SecretAccessKey)
-	if err != nil {
+
+	if err = writeCredentials(credentialsPath, p.Name, c, g.credentialsBackup); err != nil {
 		return err
 	}
-	_, err = iniProfile.NewKey("aws_session_token", *o.Credentials.SessionToken)
+
+	return writeConfig(configPath, p, c, g.credentialsBackup)
+}
+
+// LoadProfile returns the settings of the profile p saved in the config file
+// by SaveProfile. The fields missing from the file are left empty.
+func (g *GSuite) LoadProfile(p string) (Profile, error) {
+	if p == "" {
+		p = "default"
+	}
+
+	path, err := g.configFile()
 	if err != nil {
-		return err
+		return Profile{Name: p}, err
 	}
 
-	err = config.SaveTo(sharedCredentialsFile)
+	return readConfig(path, p)
+}
+
+// CachedCredentials returns the credentials of the profile p saved in the
+// shared credentials file, as long as they are valid for longer than the
+// refresh window. It returns nil when a new login is required.
+func (g *GSuite) CachedCredentials(p string) (*sts.Credentials, error) {
+	path, err := g.credentialsFile()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	c, err := readCredentials(path, p)
+	if err != nil || !CredentialsValid(c, g.refreshWindow) {
+		return nil, err
 	}
 
-	return nil
+	return c, nil
 }
@@ -0,0 +1,577 @@
+package saml_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/talos-systems/go-gsuite/saml"
+	"github.com/talos-systems/go-gsuite/saml/samltest"
+)
+
+const (
+	idpid      = "C01abc2de"
+	spid       = "123456789012"
+	totpSecret = "JBSWY3DPEHPK3PXP"
+)
+
+var roles = []samltest.Role{
+	{AccountID: "123456789012", AccountAlias: "dev", Name: "Admin", MaxSessionDuration: 4 * 3600},
+	{AccountID: "123456789012", AccountAlias: "dev", Name: "ReadOnly"},
+	{AccountID: "210987654321", Name: "Deploy"},
+}
+
+func newServer() *samltest.Server {
+	return samltest.NewServer(idpid, spid,
+		samltest.User{Email: "nomfa@example.com", Password: "secret", Roles: roles},
+		samltest.User{Email: "totp@example.com", Password: "secret", TOTPSecret: totpSecret, Roles: roles},
+		samltest.User{Email: "captcha@example.com", Password: "secret", CAPTCHA: "xkcd", Roles: roles},
+		samltest.User{Email: "prompt@example.com", Password: "secret", Prompt: samltest.PromptApprove, Roles: roles},
+		samltest.User{Email: "deny@example.com", Password: "secret", Prompt: samltest.PromptDeny, Roles: roles},
+		samltest.User{Email: "ignore@example.com", Password: "secret", Prompt: samltest.PromptIgnore, Roles: roles},
+		samltest.User{Email: "both@example.com", Password: "secret", Prompt: samltest.PromptIgnore, TOTPSecret: totpSecret, Roles: roles},
+		samltest.User{Email: "either@example.com", Password: "secret", Prompt: samltest.PromptApprove, TOTPSecret: totpSecret, Roles: roles},
+	)
+}
+
+func login(t *testing.T, s *samltest.Server, p saml.Prompter, email, password string, opts ...saml.Option) (saml.Accounts, error) {
+	opts = append([]saml.Option{saml.WithAccountsURL(s.AccountsURL())}, opts...)
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, p, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g.Login(email, password)
+}
+
+func checkAccounts(t *testing.T, accounts saml.Accounts) {
+	expected := map[string][]string{
+		"Account: dev (123456789012)": {"arn:aws:iam::123456789012:role/Admin", "arn:aws:iam::123456789012:role/ReadOnly"},
+		"Account: 210987654321":       {"arn:aws:iam::210987654321:role/Deploy"},
+	}
+
+	if len(accounts) != len(expected) {
+		t.Fatalf("expected %d accounts, got %+v", len(expected), accounts)
+	}
+
+	for _, account := range accounts {
+		arns, ok := expected[account.Name]
+		if !ok || len(arns) != len(account.Roles) {
+			t.Errorf("unexpected account %+v", account)
+			continue
+		}
+
+		for i, role := range account.Roles {
+			if role.ARN.String() != arns[i] {
+				t.Errorf("expected role %s, got %s", arns[i], role.ARN)
+			}
+		}
+	}
+
+	dev, ok := accounts.Account("dev")
+	if !ok || dev.ID != "123456789012" {
+		t.Errorf("expected account dev, got %+v", dev)
+	}
+
+	role, err := accounts.Role("210987654321", "Deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role.PrincipalARN.String() != roles[2].PrincipalARN() {
+		t.Errorf("expected principal %s, got %s", roles[2].PrincipalARN(), role.PrincipalARN)
+	}
+}
+
+func TestLoginWithoutMFA(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	// Any prompt fails the login.
+	accounts, err := login(t, s, saml.NonInteractivePrompter{}, "nomfa@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAccounts(t, accounts)
+}
+
+func TestLoginWithoutAccountNameLookup(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{}, saml.WithAccountsURL(s.AccountsURL()), saml.WithAccountNameLookup(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := g.Login("nomfa@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 2 || accounts[0].Name != "Account: 123456789012" || accounts[1].Name != "Account: 210987654321" {
+		t.Errorf("unexpected accounts %+v", accounts)
+	}
+
+	a := g.Assertion()
+	if a.RoleSessionName != "nomfa@example.com" || a.Destination != s.AWSSignInURL() {
+		t.Errorf("unexpected assertion %+v", a)
+	}
+
+	if a.Roles[0].PrincipalARN.String() != roles[0].PrincipalARN() {
+		t.Errorf("expected principal %s, got %s", roles[0].PrincipalARN(), a.Roles[0].PrincipalARN)
+	}
+}
+
+func TestRetrieveRoleCredentialsNotGranted(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{}, saml.WithAccountsURL(s.AccountsURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.RetrieveRoleCredentials(roles[0].ARN(), 3600); !errors.Is(err, saml.ErrNoAssertion) {
+		t.Errorf("expected %v, got %v", saml.ErrNoAssertion, err)
+	}
+
+	if _, err = g.Login("nomfa@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.RetrieveRoleCredentials("arn:aws:iam::123456789012:role/Other", 3600); !errors.Is(err, saml.ErrRoleNotGranted) {
+		t.Errorf("expected %v, got %v", saml.ErrRoleNotGranted, err)
+	}
+}
+
+func TestLoginTOTP(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	p := saml.NewTOTPPrompter(&saml.TOTP{Secret: totpSecret}, nil)
+
+	accounts, err := login(t, s, p, "totp@example.com", "secret", saml.WithUserAgent("samltest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAccounts(t, accounts)
+}
+
+func TestLoginRetriesPIN(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	pin, err := (&saml.TOTP{Secret: totpSecret}).Generate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := login(t, s, &saml.ScriptedPrompter{PINs: []string{"000000", pin}}, "totp@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAccounts(t, accounts)
+}
+
+func TestLoginPrompt(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	accounts, err := login(t, s, saml.NonInteractivePrompter{}, "prompt@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAccounts(t, accounts)
+}
+
+func TestLoginPromptDenied(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	_, err := login(t, s, saml.NonInteractivePrompter{}, "deny@example.com", "secret")
+	if err == nil || errors.Cause(err).Error() != "the sign-in prompt was denied" {
+		t.Errorf("expected the prompt to be denied, got %v", err)
+	}
+}
+
+func TestLoginPromptNotAnswered(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	_, err := login(t, s, saml.NonInteractivePrompter{}, "ignore@example.com", "secret", saml.WithPromptTimeout(100*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{}, saml.WithAccountsURL(s.AccountsURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err = g.LoginContext(ctx, "ignore@example.com", "secret"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestLoginChallengePreference(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	for _, tt := range []struct {
+		email      string
+		preference string
+		prompter   saml.Prompter
+		expected   string
+	}{
+		// The prompt Google asks for first is never answered, so the login
+		// only succeeds by switching to the authenticator app.
+		{"both@example.com", "totp,prompt,sms", saml.NewTOTPPrompter(&saml.TOTP{Secret: totpSecret}, nil), ""},
+		// No code can be entered, so the login only succeeds by switching
+		// back to the prompt.
+		{"either@example.com", "sms,prompt,totp", saml.NonInteractivePrompter{}, ""},
+		{"both@example.com", "sms,voice", saml.NonInteractivePrompter{}, "none of the preferred challenges [sms voice] is offered"},
+	} {
+		preference, err := saml.ParseChallengePreference(tt.preference)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		accounts, err := login(t, s, tt.prompter, tt.email, "secret",
+			saml.WithChallengePreference(preference...),
+			saml.WithPromptTimeout(100*time.Millisecond),
+		)
+
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("%s with %s: %v", tt.email, tt.preference, err)
+		case tt.expected == "":
+			checkAccounts(t, accounts)
+		case err == nil || errors.Cause(err).Error() != tt.expected:
+			t.Errorf("%s with %s: expected %q, got %v", tt.email, tt.preference, tt.expected, err)
+		}
+	}
+}
+
+func TestLoginCAPTCHA(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	accounts, err := login(t, s, &saml.ScriptedPrompter{CAPTCHAs: []string{"xkcd"}}, "captcha@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAccounts(t, accounts)
+
+	if _, err = login(t, s, saml.NonInteractivePrompter{}, "captcha@example.com", "secret"); !errors.Is(err, saml.ErrCaptchaRequired) {
+		t.Errorf("expected %v, got %v", saml.ErrCaptchaRequired, err)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	if _, err := login(t, s, saml.NonInteractivePrompter{}, "nomfa@example.com", "wrong"); !errors.Is(err, saml.ErrWrongPassword) {
+		t.Errorf("expected %v, got %v", saml.ErrWrongPassword, err)
+	}
+
+	if _, err := login(t, s, &saml.ScriptedPrompter{PINs: []string{"000000", "111111"}}, "totp@example.com", "secret"); !errors.Is(err, saml.ErrWrongPIN) {
+		t.Errorf("expected %v, got %v", saml.ErrWrongPIN, err)
+	}
+
+	g, err := saml.NewGSuiteSAMLLogin("unknown", spid, saml.NonInteractivePrompter{}, saml.WithAccountsURL(s.AccountsURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.Login("nomfa@example.com", "secret"); !errors.Is(err, saml.ErrSAMLNotConfigured) {
+		t.Errorf("expected %v, got %v", saml.ErrSAMLNotConfigured, err)
+	}
+}
+
+func TestLoginContextCancelled(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{}, saml.WithAccountsURL(s.AccountsURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err = g.LoginContext(ctx, "nomfa@example.com", "secret"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestLoginAssertionValidation(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	other := samltest.NewServer(idpid, spid)
+	defer other.Close()
+
+	for _, tc := range []struct {
+		name     string
+		server   *samltest.Server
+		expected error
+	}{
+		{"trusted", s, nil},
+		{"untrusted", other, saml.ErrInvalidSignature},
+	} {
+		certs, err := saml.ParseIdPCertificates(tc.server.Metadata())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = login(t, s, saml.NonInteractivePrompter{}, "nomfa@example.com", "secret", saml.WithAssertionValidation(saml.ValidationPolicy{
+			Certificates: certs,
+			Issuer:       "https://accounts.google.com/o/saml2?idpid=" + idpid,
+		}))
+
+		if tc.expected == nil && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+
+		if tc.expected != nil && !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, err)
+		}
+	}
+
+	_, err := login(t, s, saml.NonInteractivePrompter{}, "nomfa@example.com", "secret",
+		saml.WithAWSSignInURL("https://signin.aws.amazon.com/saml"),
+		saml.WithAssertionValidation(saml.ValidationPolicy{}),
+	)
+	if !errors.Is(err, saml.ErrDestinationMismatch) {
+		t.Errorf("expected %v, got %v", saml.ErrDestinationMismatch, err)
+	}
+}
+
+func TestValidateTamperedAssertion(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	if _, err := login(t, s, saml.NonInteractivePrompter{}, "nomfa@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := saml.ParseIdPCertificates(s.CertificatePEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(s.SAMLResponse("nomfa@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := saml.ParseAssertion(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Validate(saml.ValidationPolicy{Certificates: certs}); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered, err := saml.ParseAssertion(bytes.Replace(raw, []byte("role/ReadOnly"), []byte("role/Admin2"), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tampered.Validate(saml.ValidationPolicy{Certificates: certs}); !errors.Is(err, saml.ErrInvalidSignature) {
+		t.Errorf("expected %v, got %v", saml.ErrInvalidSignature, err)
+	}
+}
+
+func TestRetrieveRoleCredentials(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{}, saml.WithAccountsURL(s.AccountsURL()), saml.WithSTSEndpoint(s.STSURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := g.Login("nomfa@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role, err := accounts.Role("dev", "Admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := g.RetrieveRoleCredentials(role.ARN.String(), 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Credentials == nil || *o.AssumedRoleUser.Arn != "arn:aws:sts::123456789012:assumed-role/Admin/nomfa@example.com" {
+		t.Errorf("unexpected output %v", o)
+	}
+
+	o, granted, err := g.RetrieveMaxDurationCredentials(role.ARN.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if granted != 4*3600 || time.Until(*o.Credentials.Expiration) < 3*time.Hour {
+		t.Errorf("expected a 4h session, got %d seconds expiring at %s", granted, o.Credentials.Expiration)
+	}
+}
+
+func TestRetrieveRoleCredentialsPartition(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{},
+		saml.WithAccountsURL(s.AccountsURL()),
+		saml.WithPartition("aws-cn"),
+		saml.WithAWSSignInURL(s.AWSSignInURL()),
+		saml.WithSTSEndpoint(s.STSURL()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.Login("nomfa@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.RetrieveRoleCredentials(roles[0].ARN(), 3600); !errors.Is(err, saml.ErrPartitionMismatch) {
+		t.Errorf("expected %v, got %v", saml.ErrPartitionMismatch, err)
+	}
+}
+
+func TestRetrieveChainedCredentials(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	p := &saml.ScriptedPrompter{PINs: []string{"123456"}}
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, p, saml.WithAccountsURL(s.AccountsURL()), saml.WithSTSEndpoint(s.STSURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.Login("nomfa@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := g.RetrieveChainedCredentials(roles[0].ARN(), 3600,
+		saml.ChainedRole{ARN: "arn:aws:iam::333333333333:role/Workload", ExternalID: "hub"},
+		saml.ChainedRole{ARN: "arn:aws:iam::444444444444:role/Deep", SessionName: "deep", SerialNumber: "arn:aws:iam::123456789012:mfa/jane"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds == nil || creds.AccessKeyId == nil {
+		t.Fatalf("expected credentials, got %v", creds)
+	}
+
+	requests := s.AssumeRoleRequests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 AssumeRole requests, got %+v", requests)
+	}
+
+	expected := []samltest.AssumeRoleRequest{
+		{
+			CallerARN:       "arn:aws:sts::123456789012:assumed-role/Admin/nomfa@example.com",
+			RoleARN:         "arn:aws:iam::333333333333:role/Workload",
+			RoleSessionName: "nomfa@example.com",
+			ExternalID:      "hub",
+			DurationSeconds: 3600,
+		},
+		{
+			CallerARN:       "arn:aws:sts::333333333333:assumed-role/Workload/nomfa@example.com",
+			RoleARN:         "arn:aws:iam::444444444444:role/Deep",
+			RoleSessionName: "deep",
+			SerialNumber:    "arn:aws:iam::123456789012:mfa/jane",
+			TokenCode:       "123456",
+			DurationSeconds: 3600,
+		},
+	}
+
+	for i := range expected {
+		if !reflect.DeepEqual(requests[i], expected[i]) {
+			t.Errorf("expected request %+v, got %+v", expected[i], requests[i])
+		}
+	}
+
+	if _, err = g.RetrieveChainedCredentials(roles[0].ARN(), 3600, saml.ChainedRole{ARN: "arn:aws:iam::333333333333:role/Workload", Duration: 7200}); err == nil {
+		t.Error("expected chaining for more than an hour to fail")
+	}
+}
+
+func TestAssumeRoleSession(t *testing.T) {
+	s := samltest.NewServer(idpid, spid, samltest.User{
+		Email:          "jane.doe@example.com",
+		Password:       "secret",
+		Roles:          roles,
+		SourceIdentity: "jane.doe@example.com",
+		PrincipalTags:  map[string]string{"Team": "platform"},
+	})
+	defer s.Close()
+
+	g, err := saml.NewGSuiteSAMLLogin(idpid, spid, saml.NonInteractivePrompter{},
+		saml.WithAccountsURL(s.AccountsURL()),
+		saml.WithSTSEndpoint(s.STSURL()),
+		saml.WithRoleSessionName("gsuite+{{.User}}"),
+		saml.WithSourceIdentity("{{.Email}}"),
+		saml.WithSessionTags(map[string]string{"CostCenter": "1234"}, true),
+		saml.WithSessionTags(map[string]string{"Tool": "go gsuite"}, false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = g.Login("jane.doe@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if a := g.Assertion(); a.SourceIdentity != "jane.doe@example.com" || a.PrincipalTags["Team"] != "platform" {
+		t.Errorf("unexpected assertion %+v", a)
+	}
+
+	if _, err = g.RetrieveChainedCredentials(roles[0].ARN(), 3600, saml.ChainedRole{ARN: "arn:aws:iam::333333333333:role/Workload"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := samltest.AssumeRoleRequest{
+		CallerARN:         "arn:aws:sts::123456789012:assumed-role/Admin/jane.doe@example.com",
+		RoleARN:           "arn:aws:iam::333333333333:role/Workload",
+		RoleSessionName:   "gsuite+jane.doe",
+		DurationSeconds:   3600,
+		SourceIdentity:    "jane.doe@example.com",
+		Tags:              map[string]string{"CostCenter": "1234", "Tool": "go gsuite"},
+		TransitiveTagKeys: []string{"CostCenter"},
+	}
+
+	if requests := s.AssumeRoleRequests(); len(requests) != 1 || !reflect.DeepEqual(requests[0], expected) {
+		t.Errorf("expected request %+v, got %+v", expected, requests)
+	}
+}
@@ -0,0 +1,356 @@
+package saml
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Option configures a *GSuite.
+type Option func(*settings) error
+
+// settings holds the configuration set by the options.
+type settings struct {
+	client         *http.Client
+	transport      http.RoundTripper
+	proxy          *url.URL
+	requestTimeout time.Duration
+	accountsURL    string
+	awsSignInURL   string
+	userAgent      string
+	promptTimeout  time.Duration
+
+	accountNameLookup   bool
+	validation          *ValidationPolicy
+	challengePreference []ChallengeType
+
+	partition string
+	stsRegion string
+	stsURL    string
+
+	roleSessionName *template.Template
+	sourceIdentity  *template.Template
+	sessionTags     map[string]string
+	transitiveTags  map[string]bool
+
+	credentialsBackup bool
+	credentialsPath   string
+	configPath        string
+	refreshWindow     time.Duration
+	cacheDir          string
+}
+
+func defaultSettings() settings {
+	return settings{
+		accountsURL:       defaultAccountsURL,
+		accountNameLookup: true,
+		refreshWindow:     defaultRefreshWindow,
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to talk to Google and AWS. A
+// cookie jar is added to a copy of the client when it has none.
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *settings) error {
+		if c == nil {
+			return errors.New("HTTP client is nil")
+		}
+
+		s.client = c
+
+		return nil
+	}
+}
+
+// WithTransport sets the transport of the HTTP client.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(s *settings) error {
+		s.transport = rt
+
+		return nil
+	}
+}
+
+// WithProxy sends the requests through the HTTP proxy at proxyURL. It
+// requires the transport to be an *http.Transport.
+func WithProxy(proxyURL string) Option {
+	return func(s *settings) (err error) {
+		if s.proxy, err = url.Parse(proxyURL); err != nil {
+			return errors.Wrap(err, "invalid proxy URL")
+		}
+
+		return nil
+	}
+}
+
+// WithRequestTimeout limits the time each HTTP request may take.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *settings) error {
+		s.requestTimeout = d
+
+		return nil
+	}
+}
+
+// WithAccountsURL overrides the base URL of the Google accounts service,
+// https://accounts.google.com.
+func WithAccountsURL(u string) Option {
+	return func(s *settings) error {
+		if _, err := url.Parse(u); err != nil {
+			return errors.Wrap(err, "invalid accounts URL")
+		}
+
+		s.accountsURL = strings.TrimSuffix(u, "/")
+
+		return nil
+	}
+}
+
+// WithAWSSignInURL overrides the URL the SAMLResponse is posted to. By
+// default, it is the URL Google posts the SAMLResponse to.
+func WithAWSSignInURL(u string) Option {
+	return func(s *settings) error {
+		if _, err := url.Parse(u); err != nil {
+			return errors.Wrap(err, "invalid AWS sign-in URL")
+		}
+
+		s.awsSignInURL = u
+
+		return nil
+	}
+}
+
+// WithPartition selects the AWS partition: aws, aws-us-gov or aws-cn. The
+// SAMLResponse is posted to the sign-in page of the partition, unless
+// WithAWSSignInURL is given, and only roles of the partition can be assumed.
+func WithPartition(id string) Option {
+	return func(s *settings) error {
+		if _, ok := partitions[id]; !ok {
+			return errors.Errorf("unknown partition %q", id)
+		}
+
+		s.partition = id
+
+		return nil
+	}
+}
+
+// WithSTSRegion sends the STS requests to the regional endpoint of region,
+// e.g. sts.eu-west-1.amazonaws.com. The partition is implied by the region.
+func WithSTSRegion(region string) Option {
+	return func(s *settings) error {
+		s.stsRegion = region
+
+		return nil
+	}
+}
+
+// WithSTSEndpoint sends the STS requests to the URL u, e.g. a VPC endpoint or
+// a local stand-in for tests.
+func WithSTSEndpoint(u string) Option {
+	return func(s *settings) error {
+		if _, err := url.Parse(u); err != nil {
+			return errors.Wrap(err, "invalid STS endpoint")
+		}
+
+		s.stsURL = u
+
+		return nil
+	}
+}
+
+// WithRoleSessionName sets the RoleSessionName of the roles assumed with
+// sts:AssumeRole to the text/template tmpl, executed with a SessionData, e.g.
+// "{{.User}}". Characters STS does not accept are replaced with dashes. It
+// defaults to the RoleSessionName asserted by Google.
+func WithRoleSessionName(tmpl string) Option {
+	return func(s *settings) (err error) {
+		s.roleSessionName, err = parseSessionTemplate("RoleSessionName", tmpl)
+
+		return err
+	}
+}
+
+// WithSourceIdentity sets the SourceIdentity of the roles assumed with
+// sts:AssumeRole to the text/template tmpl, executed with a SessionData, e.g.
+// "{{.Email}}".
+func WithSourceIdentity(tmpl string) Option {
+	return func(s *settings) (err error) {
+		s.sourceIdentity, err = parseSessionTemplate("SourceIdentity", tmpl)
+
+		return err
+	}
+}
+
+// WithSessionTags adds tags to the sessions of the roles assumed with
+// sts:AssumeRole. Transitive tags are passed on to the next roles of a
+// chain.
+func WithSessionTags(tags map[string]string, transitive bool) Option {
+	return func(s *settings) error {
+		if s.sessionTags == nil {
+			s.sessionTags = map[string]string{}
+			s.transitiveTags = map[string]bool{}
+		}
+
+		for key, value := range tags {
+			s.sessionTags[key] = value
+			s.transitiveTags[key] = transitive
+		}
+
+		return nil
+	}
+}
+
+// WithCredentialsFile sets the path of the shared credentials file, which
+// otherwise is AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials.
+func WithCredentialsFile(path string) Option {
+	return func(s *settings) error {
+		s.credentialsPath = path
+
+		return nil
+	}
+}
+
+// WithConfigFile sets the path of the config file, which otherwise is
+// AWS_CONFIG_FILE or ~/.aws/config.
+func WithConfigFile(path string) Option {
+	return func(s *settings) error {
+		s.configPath = path
+
+		return nil
+	}
+}
+
+// WithCredentialsBackup keeps the previous content of the credentials and
+// config files in .bak files next to them each time credentials are saved.
+func WithCredentialsBackup(enabled bool) Option {
+	return func(s *settings) error {
+		s.credentialsBackup = enabled
+
+		return nil
+	}
+}
+
+// WithRefreshWindow sets how long before their expiration saved credentials
+// are considered stale by CachedCredentials. It defaults to five minutes.
+func WithRefreshWindow(d time.Duration) Option {
+	return func(s *settings) error {
+		if d < 0 {
+			return errors.Errorf("invalid refresh window %s", d)
+		}
+
+		s.refreshWindow = d
+
+		return nil
+	}
+}
+
+// WithCacheDir sets the directory of the credential_process cache. It
+// defaults to go-gsuite in the user cache directory.
+func WithCacheDir(dir string) Option {
+	return func(s *settings) error {
+		s.cacheDir = dir
+
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests to Google and AWS.
+func WithUserAgent(ua string) Option {
+	return func(s *settings) error {
+		s.userAgent = ua
+
+		return nil
+	}
+}
+
+// WithPromptTimeout sets how long to wait for the user to respond to the
+// phone prompt. By default, the lifetime of the prompt set by Google is used.
+func WithPromptTimeout(d time.Duration) Option {
+	return func(s *settings) error {
+		s.promptTimeout = d
+
+		return nil
+	}
+}
+
+// WithChallengePreference sets the second factors to use, in order of
+// preference, e.g. as parsed by ParseChallengePreference. When the challenge
+// Google asks for first is not the most preferred one offered, the login
+// switches to it through the "Try another way" page. Without a preference,
+// the challenge Google asks for is used and the Prompter selects one only
+// when that challenge is not supported.
+func WithChallengePreference(types ...ChallengeType) Option {
+	return func(s *settings) error {
+		for _, t := range types {
+			if !isSupportedChallenge(t) {
+				return errors.Errorf("unsupported challenge %q", t)
+			}
+		}
+
+		s.challengePreference = types
+
+		return nil
+	}
+}
+
+// WithAccountNameLookup enables or disables posting the SAMLResponse to the
+// AWS role picker to find the account aliases. It is enabled by default; when
+// disabled, the login makes no request to AWS and accounts are named by ID.
+func WithAccountNameLookup(enabled bool) Option {
+	return func(s *settings) error {
+		s.accountNameLookup = enabled
+
+		return nil
+	}
+}
+
+// WithAssertionValidation validates the SAML assertion against p as soon as
+// Google issues it. The login fails with an *AssertionError when the
+// assertion is rejected.
+func WithAssertionValidation(p ValidationPolicy) Option {
+	return func(s *settings) error {
+		s.validation = &p
+
+		return nil
+	}
+}
+
+// httpClient builds the HTTP client described by the settings.
+func (s *settings) httpClient() (*http.Client, error) {
+	c := &http.Client{}
+	if s.client != nil {
+		copied := *s.client
+		c = &copied
+	}
+
+	if s.transport != nil {
+		c.Transport = s.transport
+	}
+
+	if s.proxy != nil {
+		rt := c.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return nil, errors.Errorf("proxy requires an *http.Transport, got %T", rt)
+		}
+
+		t = t.Clone()
+		t.Proxy = http.ProxyURL(s.proxy)
+		c.Transport = t
+	}
+
+	if s.requestTimeout != 0 {
+		c.Timeout = s.requestTimeout
+	}
+
+	return c, nil
+}
@@ -0,0 +1,96 @@
+package saml
+
+import (
+	"context"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pageType classifies the pages rendered during the Google authn flow.
+type pageType int
+
+const (
+	pageUnknown pageType = iota
+	pageLogin
+	pagePassword
+	pageAccountChooser
+	pageInterstitial
+	pageCAPTCHA
+	pageChallengeList
+	pageChallenge
+	pageSAML
+	pageError
+)
+
+var pageTypeNames = map[pageType]string{
+	pageUnknown:        "unknown",
+	pageLogin:          "login",
+	pagePassword:       "password",
+	pageAccountChooser: "account chooser",
+	pageInterstitial:   "interstitial",
+	pageCAPTCHA:        "CAPTCHA",
+	pageChallengeList:  "challenge list",
+	pageChallenge:      "challenge",
+	pageSAML:           "SAML response",
+	pageError:          "error",
+}
+
+func (p pageType) String() string {
+	return pageTypeNames[p]
+}
+
+// interstitialSelector matches the form of pages such as "Verify it's you"
+// that Google shows between the regular steps.
+const interstitialSelector = "form[action*='/signin/speedbump/']"
+
+// classifyPage returns the type of the page rendered in doc. The order of the
+// checks matters: the SAML response wins over everything else, and the
+// CAPTCHA is rendered within the password form.
+func classifyPage(doc *goquery.Document) pageType {
+	switch {
+	case isSAMLPage(doc):
+		return pageSAML
+	case doc.Find("#af-error-container").Length() > 0:
+		return pageError
+	case doc.Find(".captcha-container").Length() > 0:
+		return pageCAPTCHA
+	case isChallengeList(doc):
+		return pageChallengeList
+	case doc.Find("#gaia_loginform input[name=Passwd]").Length() > 0:
+		return pagePassword
+	case doc.Find("#gaia_loginform").Length() > 0:
+		return pageLogin
+	case doc.Find("form#account-chooser").Length() > 0:
+		return pageAccountChooser
+	case doc.Find(interstitialSelector).Length() > 0:
+		return pageInterstitial
+	}
+
+	if _, _, ok := challengeOf(doc); ok {
+		return pageChallenge
+	}
+
+	return pageUnknown
+}
+
+// isSAMLPage reports whether doc carries the SAMLResponse. Google may render
+// it after any step, e.g. right after the password for accounts without
+// 2-step verification, so every step checks for it.
+func isSAMLPage(doc *goquery.Document) bool {
+	return doc.Find("input[name='SAMLResponse']").Length() > 0
+}
+
+// pageHandler responds to a page and returns the next one.
+type pageHandler func(ctx context.Context, doc *goquery.Document) (*goquery.Document, error)
+
+func (g *GSuite) pageHandlers() map[pageType]pageHandler {
+	return map[pageType]pageHandler{
+		pageLogin:          g.enterEmail,
+		pagePassword:       g.enterPassword,
+		pageAccountChooser: g.chooseAccount,
+		pageInterstitial:   g.confirmInterstitial,
+		pageCAPTCHA:        g.enterCAPTCHA,
+		pageChallengeList:  g.enterChallenge,
+		pageChallenge:      g.enterChallenge,
+	}
+}
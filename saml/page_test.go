@@ -0,0 +1,44 @@
+package saml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestClassifyPage(t *testing.T) {
+	for _, tt := range []struct {
+		html string
+		page pageType
+	}{
+		{`<form id="gaia_loginform" action="/signin/v1/lookup"><input name="Email"></form>`, pageLogin},
+		{`<form id="gaia_loginform" action="/signin/challenge/sl/password"><input type="hidden" name="Email"><input type="password" name="Passwd"></form>`, pagePassword},
+		{`<form id="gaia_loginform" action="/signin/challenge/sl/password"><input type="password" name="Passwd"><div class="captcha-container"><input name="url"></div></form>`, pageCAPTCHA},
+		{`<form id="account-chooser" action="/AccountChooser"><button name="Email" value="a@example.com"></button></form>`, pageAccountChooser},
+		{`<h1>Verify it's you</h1><form action="/signin/speedbump/verify"><input type="submit"></form>`, pageInterstitial},
+		{`<form action="/signin/challenge/totp/2"><input name="Pin"></form>`, pageChallenge},
+		{`<form action="https://signin.aws.amazon.com/saml"><input type="hidden" name="SAMLResponse" value="PD94"></form>`, pageSAML},
+		{`<div id="af-error-container"><p><b>403.</b> <ins>That’s an error.</ins></p></div>`, pageError},
+		{`<p>Hello</p>`, pageUnknown},
+	} {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if page := classifyPage(doc); page != tt.page {
+			t.Errorf("expected %s page, got %s for %s", tt.page, page, tt.html)
+		}
+	}
+
+	for fixture, page := range map[string]pageType{
+		"challenge_list.html":        pageChallengeList,
+		"challenge_sms_send.html":    pageChallenge,
+		"challenge_backup_used.html": pageChallenge,
+	} {
+		if got := classifyPage(loadFixture(t, fixture)); got != page {
+			t.Errorf("%s: expected %s page, got %s", fixture, page, got)
+		}
+	}
+}
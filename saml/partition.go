@@ -0,0 +1,112 @@
+package saml
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+)
+
+// partition describes the endpoints of an AWS partition.
+type partition struct {
+	id            string
+	signInURL     string
+	defaultRegion string
+	dnsSuffix     string
+}
+
+var partitions = map[string]partition{
+	"aws": {
+		id:            "aws",
+		signInURL:     "https://signin.aws.amazon.com/saml",
+		defaultRegion: "us-east-1",
+		dnsSuffix:     "amazonaws.com",
+	},
+	"aws-us-gov": {
+		id:            "aws-us-gov",
+		signInURL:     "https://signin.amazonaws-us-gov.com/saml",
+		defaultRegion: "us-gov-west-1",
+		dnsSuffix:     "amazonaws.com",
+	},
+	"aws-cn": {
+		id:            "aws-cn",
+		signInURL:     "https://signin.amazonaws.cn/saml",
+		defaultRegion: "cn-north-1",
+		dnsSuffix:     "amazonaws.com.cn",
+	},
+}
+
+// regionPartition returns the ID of the partition region belongs to.
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	default:
+		return "aws"
+	}
+}
+
+// resolvePartition returns the partition configured explicitly or implied by
+// the STS region, and checks that both agree.
+func (s *settings) resolvePartition() (partition, error) {
+	id := s.partition
+	if s.stsRegion != "" {
+		implied := regionPartition(s.stsRegion)
+		if id != "" && id != implied {
+			return partition{}, errors.Errorf("region %s is not in partition %s", s.stsRegion, id)
+		}
+
+		id = implied
+	}
+
+	if id == "" {
+		id = "aws"
+	}
+
+	return partitions[id], nil
+}
+
+// stsEndpoint returns the region and the URL of the STS endpoint. An empty
+// URL selects the endpoint the AWS SDK resolves for the region.
+func (s *settings) stsEndpoint() (region, endpoint string, err error) {
+	p, err := s.resolvePartition()
+	if err != nil {
+		return "", "", err
+	}
+
+	region = s.stsRegion
+	if region == "" {
+		region = p.defaultRegion
+	}
+
+	switch {
+	case s.stsURL != "":
+		endpoint = s.stsURL
+	case s.stsRegion != "":
+		endpoint = "https://sts." + s.stsRegion + "." + p.dnsSuffix
+	}
+
+	return region, endpoint, nil
+}
+
+// checkPartition returns an error wrapping ErrPartitionMismatch when the ARN
+// a is not in the configured partition.
+func (s *settings) checkPartition(a string) error {
+	p, err := s.resolvePartition()
+	if err != nil {
+		return err
+	}
+
+	parsed, err := arn.Parse(a)
+	if err != nil {
+		return errors.Wrapf(err, "invalid ARN %q", a)
+	}
+
+	if parsed.Partition != p.id {
+		return errors.Wrapf(ErrPartitionMismatch, "%s is not in partition %s", a, p.id)
+	}
+
+	return nil
+}
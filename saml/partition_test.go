@@ -0,0 +1,71 @@
+package saml
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSTSEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     []Option
+		region   string
+		endpoint string
+	}{
+		{"default", nil, "us-east-1", ""},
+		{"regional", []Option{WithSTSRegion("eu-west-1")}, "eu-west-1", "https://sts.eu-west-1.amazonaws.com"},
+		{"GovCloud", []Option{WithPartition("aws-us-gov")}, "us-gov-west-1", ""},
+		{"China", []Option{WithSTSRegion("cn-northwest-1")}, "cn-northwest-1", "https://sts.cn-northwest-1.amazonaws.com.cn"},
+		{"custom", []Option{WithSTSRegion("eu-west-1"), WithSTSEndpoint("http://localhost:8080")}, "eu-west-1", "http://localhost:8080"},
+	} {
+		s := defaultSettings()
+		for _, opt := range tc.opts {
+			if err := opt(&s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		region, endpoint, err := s.stsEndpoint()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if region != tc.region || endpoint != tc.endpoint {
+			t.Errorf("%s: expected (%s, %s), got (%s, %s)", tc.name, tc.region, tc.endpoint, region, endpoint)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	if err := WithPartition("aws-iso")(&settings{}); err == nil {
+		t.Error("expected an error for an unknown partition")
+	}
+
+	s := defaultSettings()
+	s.partition = "aws-cn"
+	s.stsRegion = "eu-west-1"
+
+	if _, err := s.resolvePartition(); err == nil {
+		t.Error("expected an error for a region outside of the partition")
+	}
+
+	s.stsRegion = ""
+
+	if err := s.checkPartition("arn:aws-cn:iam::123456789012:role/Admin"); err != nil {
+		t.Error(err)
+	}
+
+	if err := s.checkPartition("arn:aws:iam::123456789012:role/Admin"); !errors.Is(err, ErrPartitionMismatch) {
+		t.Errorf("expected %v, got %v", ErrPartitionMismatch, err)
+	}
+
+	g, err := NewGSuiteSAMLLogin("", "", NonInteractivePrompter{}, WithPartition("aws-us-gov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.signInURL() != "https://signin.amazonaws-us-gov.com/saml" {
+		t.Errorf("unexpected sign-in URL %s", g.signInURL())
+	}
+}
@@ -0,0 +1,217 @@
+package saml
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// ProcessCredentials is the output of a credential_process, as read by the
+// AWS SDKs and CLI.
+type ProcessCredentials struct {
+	Version         int
+	AccessKeyID     string     `json:"AccessKeyId"`
+	SecretAccessKey string     `json:"SecretAccessKey"`
+	SessionToken    string     `json:"SessionToken"`
+	Expiration      *time.Time `json:"Expiration,omitempty"`
+}
+
+// NewProcessCredentials converts c to the credential_process output.
+func NewProcessCredentials(c *sts.Credentials) *ProcessCredentials {
+	p := &ProcessCredentials{
+		Version:         1,
+		AccessKeyID:     aws.StringValue(c.AccessKeyId),
+		SecretAccessKey: aws.StringValue(c.SecretAccessKey),
+		SessionToken:    aws.StringValue(c.SessionToken),
+	}
+
+	if c.Expiration != nil {
+		t := c.Expiration.UTC()
+		p.Expiration = &t
+	}
+
+	return p
+}
+
+// Credentials converts p back to STS credentials.
+func (p *ProcessCredentials) Credentials() *sts.Credentials {
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(p.AccessKeyID),
+		SecretAccessKey: aws.String(p.SecretAccessKey),
+		SessionToken:    aws.String(p.SessionToken),
+		Expiration:      p.Expiration,
+	}
+}
+
+// WriteProcessCredentials writes c to w in the JSON format expected from a
+// credential_process.
+func WriteProcessCredentials(w io.Writer, c *sts.Credentials) error {
+	return json.NewEncoder(w).Encode(NewProcessCredentials(c))
+}
+
+// cachedCredentials is an entry of the credentials cache: the
+// credential_process output and the role the credentials were issued for.
+type cachedCredentials struct {
+	ProcessCredentials
+	RoleARN string `json:"RoleArn,omitempty"`
+}
+
+// cacheFile returns the path of the cache of profile.
+func (s *settings) cacheFile(profile string) (string, error) {
+	dir := s.cacheDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to locate the cache directory")
+		}
+
+		dir = filepath.Join(cache, "go-gsuite")
+	}
+
+	if profile == "" {
+		profile = "default"
+	}
+
+	return filepath.Join(dir, url.PathEscape(profile)+".json"), nil
+}
+
+// CachedProcessCredentials returns the credentials of the profile p saved by
+// CacheProcessCredentials, as long as they are valid for longer than the
+// refresh window, along with the ARN of their role. It returns nil when a new
+// login is required. The caller must check that the role is still the one
+// of the profile.
+func (g *GSuite) CachedProcessCredentials(p string) (c *sts.Credentials, roleARN string, err error) {
+	path, err := g.cacheFile(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var cached cachedCredentials
+
+	// A cache that cannot be read is replaced by the next login.
+	if err = json.Unmarshal(data, &cached); err != nil || cached.Version != 1 {
+		return nil, "", nil
+	}
+
+	c = cached.Credentials()
+	if !CredentialsValid(c, g.refreshWindow) {
+		return nil, "", nil
+	}
+
+	return c, cached.RoleARN, nil
+}
+
+// CacheProcessCredentials saves the credentials c of the profile p, issued
+// for the role roleARN, to the cache read by CachedProcessCredentials. The
+// cache is kept apart from the shared credentials file, where credentials
+// would take precedence over the credential_process of the profile.
+func (g *GSuite) CacheProcessCredentials(p, roleARN string, c *sts.Credentials) error {
+	path, err := g.cacheFile(p)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cachedCredentials{
+		ProcessCredentials: *NewProcessCredentials(c),
+		RoleARN:            roleARN,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	return writeFileAtomic(path, data, credentialsPerm)
+}
+
+// CredentialProcessCommand joins args into a credential_process command
+// line, quoting the arguments the AWS CLI would split or unescape.
+func CredentialProcessCommand(args ...string) string {
+	quoted := make([]string, len(args))
+
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\"'\\#") {
+			quoted[i] = arg
+
+			continue
+		}
+
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// ConfigureCredentialProcess writes the settings of p to the config file
+// along with a credential_process running args, so that the AWS SDKs and CLI
+// request the credentials of the profile from that command. Credentials
+// saved to the profile in the shared credentials file would take precedence
+// over the credential_process, so they are removed.
+func (g *GSuite) ConfigureCredentialProcess(p Profile, args ...string) error {
+	if p.Name == "" {
+		p.Name = "default"
+	}
+
+	if len(args) == 0 {
+		return errors.New("the credential_process command is required")
+	}
+
+	credentialsPath, err := g.credentialsFile()
+	if err != nil {
+		return err
+	}
+
+	configPath, err := g.configFile()
+	if err != nil {
+		return err
+	}
+
+	f, err := readINIFile(credentialsPath)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := f.get(p.Name, "aws_access_key_id"); ok {
+		err = updateINIFile(credentialsPath, credentialsPerm, g.credentialsBackup, func(f *iniFile) {
+			for _, key := range []string{"aws_access_key_id", "aws_secret_access_key", "aws_session_token", credentialsExpiration} {
+				f.unset(p.Name, key)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateINIFile(configPath, configPerm, g.credentialsBackup, func(f *iniFile) {
+		setProfile(f, p)
+		f.unset(configSection(p.Name), configExpiration)
+		f.set(configSection(p.Name), "credential_process", CredentialProcessCommand(args...))
+	})
+}
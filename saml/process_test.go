@@ -0,0 +1,142 @@
+package saml
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestWriteProcessCredentials(t *testing.T) {
+	c := testCredentials("AKIAPROCESS")
+	c.Expiration = aws.Time(time.Date(2019, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60)))
+
+	var buf bytes.Buffer
+
+	if err := WriteProcessCredentials(&buf, c); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"Version":1,"AccessKeyId":"AKIAPROCESS","SecretAccessKey":"AKIAPROCESS-secret","SessionToken":"AKIAPROCESS-token","Expiration":"2019-05-01T10:00:00Z"}` + "\n"
+
+	if buf.String() != expected {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestProcessCredentialsCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	g := &GSuite{settings: settings{cacheDir: filepath.Join(dir, "cache"), refreshWindow: defaultRefreshWindow}}
+
+	const roleARN = "arn:aws:iam::123456789012:role/admin"
+
+	if c, _, err := g.CachedProcessCredentials("work"); err != nil || c != nil {
+		t.Fatalf("expected an empty cache, got %v, %v", c, err)
+	}
+
+	c := testCredentials("AKIAFRESH")
+	c.Expiration = aws.Time(time.Now().Add(time.Hour).Truncate(time.Second).UTC())
+
+	if err = g.CacheProcessCredentials("work", roleARN, c); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, role, err := g.CachedProcessCredentials("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached == nil || aws.StringValue(cached.SessionToken) != "AKIAFRESH-token" || !cached.Expiration.Equal(*c.Expiration) {
+		t.Errorf("unexpected cached credentials %v", cached)
+	}
+
+	if role != roleARN {
+		t.Errorf("expected the credentials of %s, got %s", roleARN, role)
+	}
+
+	c.Expiration = aws.Time(time.Now().Add(time.Minute))
+
+	if err = g.CacheProcessCredentials("work", roleARN, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, _, err = g.CachedProcessCredentials("work"); err != nil || cached != nil {
+		t.Errorf("expected credentials within the refresh window to be ignored, got %v, %v", cached, err)
+	}
+
+	path, _ := g.cacheFile("work")
+
+	if err = ioutil.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, _, err = g.CachedProcessCredentials("work"); err != nil || cached != nil {
+		t.Errorf("expected a corrupt cache to be ignored, got %v, %v", cached, err)
+	}
+}
+
+func TestCredentialProcessCommand(t *testing.T) {
+	cmd := CredentialProcessCommand("/opt/my tools/gsuite", "credential-process", "-email", "jane@example.com", "-role", "", `a"b\c`)
+
+	if expected := `"/opt/my tools/gsuite" credential-process -email jane@example.com -role "" "a\"b\\c"`; cmd != expected {
+		t.Errorf("expected %s, got %s", expected, cmd)
+	}
+}
+
+func TestConfigureCredentialProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsuite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	g := &GSuite{settings: settings{credentialsPath: filepath.Join(dir, "credentials"), configPath: filepath.Join(dir, "config")}}
+
+	c := testCredentials("AKIAWORK")
+	c.Expiration = aws.Time(time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	if err = g.SaveProfile(Profile{Name: "work", Region: "eu-west-1"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.ConfigureCredentialProcess(Profile{Name: "work", RoleARN: "arn:aws:iam::123456789012:role/Admin"}, "gsuite", "credential-process", "-profile", "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(g.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[profile work]
+region = eu-west-1
+gsuite_role_arn = arn:aws:iam::123456789012:role/Admin
+gsuite_account_id = 123456789012
+credential_process = gsuite credential-process -profile work
+`
+
+	if string(data) != expected {
+		t.Errorf("unexpected config file:\n%s", data)
+	}
+
+	data, err = ioutil.ReadFile(g.credentialsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "AKIAWORK") {
+		t.Errorf("expected the credentials of the profile to be removed:\n%s", data)
+	}
+}
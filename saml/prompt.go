@@ -0,0 +1,295 @@
+package saml
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Prompter is the interface used to collect input from the user during the
+// Google authn flow.
+type Prompter interface {
+	// PIN asks for the code of the second factor challenge t.
+	PIN(ctx context.Context, t ChallengeType) (string, error)
+	// CAPTCHA asks for the solution to the CAPTCHA found at url.
+	CAPTCHA(ctx context.Context, url string) (string, error)
+	// Select asks the user to pick one of options and returns its index.
+	Select(ctx context.Context, message string, options []string) (int, error)
+	// SelectChallenge asks the user to pick one of the second factor
+	// challenges offered by Google and returns its index.
+	SelectChallenge(ctx context.Context, challenges []Challenge) (int, error)
+	// Confirm asks the user a yes/no question.
+	Confirm(ctx context.Context, message string) (bool, error)
+}
+
+// NonInteractiveError is returned by a NonInteractivePrompter when input is
+// required.
+type NonInteractiveError struct {
+	Prompt string
+}
+
+func (e *NonInteractiveError) Error() string {
+	return fmt.Sprintf("input required for %s, but prompting is disabled", e.Prompt)
+}
+
+// TerminalPrompter prompts on a terminal.
+type TerminalPrompter struct {
+	in  io.Reader
+	out io.Writer
+
+	mu      sync.Mutex
+	pending chan readResult
+}
+
+// readResult is the outcome of reading a line of input.
+type readResult struct {
+	line string
+	err  error
+}
+
+// NewTerminalPrompter instantiates and returns a *TerminalPrompter that reads
+// from in and writes prompts to out.
+func NewTerminalPrompter(in io.Reader, out io.Writer) *TerminalPrompter {
+	return &TerminalPrompter{
+		in:  in,
+		out: out,
+	}
+}
+
+// NewDefaultPrompter instantiates and returns a *TerminalPrompter that uses
+// stdin and stdout.
+func NewDefaultPrompter() *TerminalPrompter {
+	return NewTerminalPrompter(os.Stdin, os.Stdout)
+}
+
+// readLine reads r up to the next newline a byte at a time, so that none of
+// the input that follows the line is consumed.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+
+	b := make([]byte, 1)
+
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			line = append(line, b[0])
+
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+		}
+
+		if err != nil {
+			if len(line) > 0 {
+				return string(line), nil
+			}
+
+			return "", err
+		}
+	}
+}
+
+// readLine reads a line of input in the background, so that the prompt can
+// be abandoned when its context is cancelled. The input is only read while a
+// prompt is pending: a line typed after a cancellation is handed to the next
+// prompt, and no input is consumed once the prompts are done.
+func (t *TerminalPrompter) readLine(ctx context.Context, prompt string) (string, error) {
+	t.mu.Lock()
+	result := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if result == nil {
+		result = make(chan readResult, 1)
+
+		go func() {
+			line, err := readLine(t.in)
+			result <- readResult{line: line, err: err}
+		}()
+	}
+
+	fmt.Fprint(t.out, prompt)
+
+	select {
+	case <-ctx.Done():
+		t.mu.Lock()
+		t.pending = result
+		t.mu.Unlock()
+
+		fmt.Fprintln(t.out)
+
+		return "", ctx.Err()
+	case r := <-result:
+		if r.err != nil {
+			return "", r.err
+		}
+
+		return strings.TrimSpace(r.line), nil
+	}
+}
+
+// PIN implements the Prompter interface.
+func (t *TerminalPrompter) PIN(ctx context.Context, c ChallengeType) (string, error) {
+	switch c {
+	case ChallengeSMS:
+		return t.readLine(ctx, "Enter the code sent by SMS: ")
+	case ChallengeVoice:
+		return t.readLine(ctx, "Enter the code from the phone call: ")
+	case ChallengeBackupCode:
+		return t.readLine(ctx, "Enter a backup code: ")
+	case AWSMFACode:
+		return t.readLine(ctx, "Enter the AWS MFA code: ")
+	default:
+		return t.readLine(ctx, "Enter PIN: ")
+	}
+}
+
+// CAPTCHA implements the Prompter interface.
+func (t *TerminalPrompter) CAPTCHA(ctx context.Context, url string) (string, error) {
+	fmt.Fprintf(t.out, "CAPTCHA URL: %s\n", url)
+
+	return t.readLine(ctx, "Enter CAPTCHA: ")
+}
+
+// Select implements the Prompter interface.
+func (t *TerminalPrompter) Select(ctx context.Context, message string, options []string) (int, error) {
+	fmt.Fprintln(t.out, message)
+	for i, option := range options {
+		fmt.Fprintf(t.out, "[%d]: \t%s\n", i+1, option)
+	}
+
+	answer, err := t.readLine(ctx, "Select an option: ")
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(answer)
+	if err != nil || i < 1 || i > len(options) {
+		return 0, errors.Errorf("invalid selection %q", answer)
+	}
+
+	// Decrement by 1 to take into consideration that we prompt starting at
+	// 1.
+	return i - 1, nil
+}
+
+// SelectChallenge implements the Prompter interface.
+func (t *TerminalPrompter) SelectChallenge(ctx context.Context, challenges []Challenge) (int, error) {
+	return t.Select(ctx, "Choose how you want to sign in:", challengeDescriptions(challenges))
+}
+
+// Confirm implements the Prompter interface.
+func (t *TerminalPrompter) Confirm(ctx context.Context, message string) (bool, error) {
+	answer, err := t.readLine(ctx, message+" [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// ScriptedPrompter answers prompts from predefined responses. It is intended
+// for tests.
+type ScriptedPrompter struct {
+	PINs          []string
+	CAPTCHAs      []string
+	Selections    []int
+	Confirmations []bool
+}
+
+// PIN implements the Prompter interface.
+func (s *ScriptedPrompter) PIN(ctx context.Context, t ChallengeType) (string, error) {
+	if len(s.PINs) == 0 {
+		return "", errors.New("scripted prompter: no PIN left")
+	}
+
+	pin := s.PINs[0]
+	s.PINs = s.PINs[1:]
+
+	return pin, nil
+}
+
+// CAPTCHA implements the Prompter interface.
+func (s *ScriptedPrompter) CAPTCHA(ctx context.Context, url string) (string, error) {
+	if len(s.CAPTCHAs) == 0 {
+		return "", errors.New("scripted prompter: no CAPTCHA left")
+	}
+
+	captcha := s.CAPTCHAs[0]
+	s.CAPTCHAs = s.CAPTCHAs[1:]
+
+	return captcha, nil
+}
+
+// Select implements the Prompter interface.
+func (s *ScriptedPrompter) Select(ctx context.Context, message string, options []string) (int, error) {
+	if len(s.Selections) == 0 {
+		return 0, errors.New("scripted prompter: no selection left")
+	}
+
+	i := s.Selections[0]
+	s.Selections = s.Selections[1:]
+
+	if i < 0 || i >= len(options) {
+		return 0, errors.Errorf("scripted prompter: selection %d out of range", i)
+	}
+
+	return i, nil
+}
+
+// SelectChallenge implements the Prompter interface. The challenge is picked
+// from Selections.
+func (s *ScriptedPrompter) SelectChallenge(ctx context.Context, challenges []Challenge) (int, error) {
+	return s.Select(ctx, "", challengeDescriptions(challenges))
+}
+
+// Confirm implements the Prompter interface.
+func (s *ScriptedPrompter) Confirm(ctx context.Context, message string) (bool, error) {
+	if len(s.Confirmations) == 0 {
+		return false, errors.New("scripted prompter: no confirmation left")
+	}
+
+	ok := s.Confirmations[0]
+	s.Confirmations = s.Confirmations[1:]
+
+	return ok, nil
+}
+
+// NonInteractivePrompter fails every prompt with a *NonInteractiveError.
+type NonInteractivePrompter struct{}
+
+// PIN implements the Prompter interface.
+func (NonInteractivePrompter) PIN(ctx context.Context, t ChallengeType) (string, error) {
+	return "", &NonInteractiveError{Prompt: "PIN"}
+}
+
+// CAPTCHA implements the Prompter interface.
+func (NonInteractivePrompter) CAPTCHA(ctx context.Context, url string) (string, error) {
+	return "", &NonInteractiveError{Prompt: "CAPTCHA"}
+}
+
+// Select implements the Prompter interface.
+func (NonInteractivePrompter) Select(ctx context.Context, message string, options []string) (int, error) {
+	return 0, &NonInteractiveError{Prompt: "selection"}
+}
+
+// SelectChallenge implements the Prompter interface.
+func (NonInteractivePrompter) SelectChallenge(ctx context.Context, challenges []Challenge) (int, error) {
+	return 0, &NonInteractiveError{Prompt: "challenge selection"}
+}
+
+// Confirm implements the Prompter interface.
+func (NonInteractivePrompter) Confirm(ctx context.Context, message string) (bool, error) {
+	return false, &NonInteractiveError{Prompt: "confirmation"}
+}
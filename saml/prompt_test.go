@@ -0,0 +1,85 @@
+package saml
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalPrompter(t *testing.T) {
+	p := NewTerminalPrompter(strings.NewReader("123456\n2\ny\n"), ioutil.Discard)
+
+	pin, err := p.PIN(context.Background(), ChallengeTOTP)
+	if err != nil || pin != "123456" {
+		t.Errorf("expected PIN 123456, got %q (%v)", pin, err)
+	}
+
+	i, err := p.Select(context.Background(), "Pick one", []string{"a", "b"})
+	if err != nil || i != 1 {
+		t.Errorf("expected selection 1, got %d (%v)", i, err)
+	}
+
+	ok, err := p.Confirm(context.Background(), "Continue?")
+	if err != nil || !ok {
+		t.Errorf("expected confirmation, got %v (%v)", ok, err)
+	}
+
+	if _, err = p.PIN(context.Background(), ChallengeTOTP); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestTerminalPrompterCancel(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	p := NewTerminalPrompter(r, ioutil.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.PIN(ctx, ChallengeTOTP); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestTerminalPrompterLeavesInput(t *testing.T) {
+	in := strings.NewReader("123456\nterraform apply\n")
+	p := NewTerminalPrompter(in, ioutil.Discard)
+
+	if pin, err := p.PIN(context.Background(), ChallengeTOTP); err != nil || pin != "123456" {
+		t.Fatalf("expected PIN 123456, got %q (%v)", pin, err)
+	}
+
+	rest, err := ioutil.ReadAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(rest) != "terraform apply\n" {
+		t.Errorf("expected the input after the prompt to be left unread, got %q", rest)
+	}
+}
+
+func TestTerminalPrompterCancelHandsLineToNextPrompt(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	p := NewTerminalPrompter(r, ioutil.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := p.PIN(ctx, ChallengeTOTP); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	go w.Write([]byte("654321\n"))
+
+	if pin, err := p.PIN(context.Background(), ChallengeTOTP); err != nil || pin != "654321" {
+		t.Errorf("expected PIN 654321, got %q (%v)", pin, err)
+	}
+}
@@ -0,0 +1,147 @@
+package samltest
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"text/template"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// assertionData holds the data rendered in the SAML response.
+type assertionData struct {
+	IdPID           string
+	Email           string
+	Destination     string
+	IssueInstant    string
+	NotBefore       string
+	NotOnOrAfter    string
+	SessionDuration int
+	Roles           []Role
+
+	SourceIdentity    string
+	PrincipalTags     map[string]string
+	TransitiveTagKeys []string
+}
+
+var assertionTemplate = template.Must(template.New("assertion").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<saml2p:Response xmlns:saml2p="urn:oasis:names:tc:SAML:2.0:protocol" Destination="{{.Destination}}" ID="_response" IssueInstant="{{.IssueInstant}}" Version="2.0">
+  <saml2:Issuer xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion">https://accounts.google.com/o/saml2?idpid={{.IdPID}}</saml2:Issuer>
+  <saml2p:Status>
+    <saml2p:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
+  </saml2p:Status>
+  <saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" ID="_assertion" IssueInstant="{{.IssueInstant}}" Version="2.0">
+    <saml2:Issuer>https://accounts.google.com/o/saml2?idpid={{.IdPID}}</saml2:Issuer>
+    <saml2:Subject>
+      <saml2:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">{{html .Email}}</saml2:NameID>
+      <saml2:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml2:SubjectConfirmationData NotOnOrAfter="{{.NotOnOrAfter}}" Recipient="{{.Destination}}"/>
+      </saml2:SubjectConfirmation>
+    </saml2:Subject>
+    <saml2:Conditions NotBefore="{{.NotBefore}}" NotOnOrAfter="{{.NotOnOrAfter}}">
+      <saml2:AudienceRestriction>
+        <saml2:Audience>urn:amazon:webservices</saml2:Audience>
+      </saml2:AudienceRestriction>
+    </saml2:Conditions>
+    <saml2:AttributeStatement>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName">
+        <saml2:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xsd:anyType">{{html .Email}}</saml2:AttributeValue>
+      </saml2:Attribute>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+      {{- range .Roles}}
+        <saml2:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xsd:anyType">{{.ARN}},{{.PrincipalARN}}</saml2:AttributeValue>
+      {{- end}}
+      </saml2:Attribute>
+      {{- if .SourceIdentity}}
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/SourceIdentity">
+        <saml2:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xsd:anyType">{{html .SourceIdentity}}</saml2:AttributeValue>
+      </saml2:Attribute>
+      {{- end}}
+      {{- range $key, $value := .PrincipalTags}}
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/PrincipalTag:{{html $key}}">
+        <saml2:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xsd:anyType">{{html $value}}</saml2:AttributeValue>
+      </saml2:Attribute>
+      {{- end}}
+      {{- if .TransitiveTagKeys}}
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/TransitiveTagKeys">
+      {{- range .TransitiveTagKeys}}
+        <saml2:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xsd:anyType">{{html .}}</saml2:AttributeValue>
+      {{- end}}
+      </saml2:Attribute>
+      {{- end}}
+      {{- if .SessionDuration}}
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/SessionDuration">
+        <saml2:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xsd:anyType">{{.SessionDuration}}</saml2:AttributeValue>
+      </saml2:Attribute>
+      {{- end}}
+    </saml2:AttributeStatement>
+    <saml2:AuthnStatement AuthnInstant="{{.IssueInstant}}" SessionIndex="_assertion">
+      <saml2:AuthnContext>
+        <saml2:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified</saml2:AuthnContextClassRef>
+      </saml2:AuthnContext>
+    </saml2:AuthnStatement>
+  </saml2:Assertion>
+</saml2p:Response>
+`))
+
+// assertion returns the SAML response issued to u at now.
+func (s *Server) assertion(u User, now time.Time) ([]byte, error) {
+	data := assertionData{
+		IdPID:           s.IdPID,
+		Email:           u.Email,
+		Destination:     s.AWSSignInURL(),
+		IssueInstant:    now.UTC().Format(time.RFC3339),
+		NotBefore:       now.Add(-5 * time.Second).UTC().Format(time.RFC3339),
+		NotOnOrAfter:    now.Add(5 * time.Minute).UTC().Format(time.RFC3339),
+		SessionDuration: u.SessionDuration,
+		Roles:           u.Roles,
+
+		SourceIdentity:    u.SourceIdentity,
+		PrincipalTags:     u.PrincipalTags,
+		TransitiveTagKeys: u.TransitiveTagKeys,
+	}
+
+	var buf bytes.Buffer
+	if err := assertionTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return s.sign(buf.Bytes())
+}
+
+// keyStore implements dsig.X509KeyStore.
+type keyStore struct {
+	key  *rsa.PrivateKey
+	cert []byte
+}
+
+func (k *keyStore) GetKeyPair() (*rsa.PrivateKey, []byte, error) {
+	return k.key, k.cert, nil
+}
+
+// sign adds an enveloped signature to the assertion of response, the way
+// Google does.
+func (s *Server) sign(response []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(response); err != nil {
+		return nil, err
+	}
+
+	assertion := doc.Root().SelectElement("Assertion")
+
+	ctx := dsig.NewDefaultSigningContext(&keyStore{key: s.key, cert: s.cert.Raw})
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	signed, err := ctx.SignEnveloped(assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	i := assertion.Index()
+	doc.Root().RemoveChildAt(i)
+	doc.Root().InsertChildAt(i, signed)
+
+	return doc.WriteToBytes()
+}
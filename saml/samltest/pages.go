@@ -0,0 +1,277 @@
+package samltest
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// page holds the data rendered in the Google pages.
+type page struct {
+	Email        string
+	Error        string
+	CAPTCHA      string
+	Action       string
+	SAMLResponse string
+
+	// AnotherWay renders the "Try another way" link of a challenge.
+	AnotherWay bool
+
+	// TxID, APIKey and GAPIURL describe the pending phone prompt.
+	TxID    string
+	APIKey  string
+	GAPIURL string
+}
+
+// account groups the roles of an AWS account on the role picker.
+type account struct {
+	ID    string
+	Alias string
+	Roles []Role
+}
+
+func accounts(roles []Role) (accounts []account) {
+	index := map[string]int{}
+
+	for _, r := range roles {
+		i, ok := index[r.AccountID]
+		if !ok {
+			i = len(accounts)
+			index[r.AccountID] = i
+			accounts = append(accounts, account{ID: r.AccountID, Alias: r.AccountAlias})
+		}
+
+		accounts[i].Roles = append(accounts[i].Roles, r)
+	}
+
+	return accounts
+}
+
+func render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var emailPage = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in - Google Accounts</title></head>
+<body>
+<h1>Sign in</h1>
+<form novalidate method="post" action="/signin/v1/lookup" id="gaia_loginform">
+  <input name="Page" type="hidden" value="PasswordSeparationSignIn">
+  <input type="hidden" name="gxf" value="AFoagUVp4Cg">
+  <input type="hidden" name="continue" value="/o/saml2/continue">
+  <input id="Email" name="Email" type="email" placeholder="Enter your email" value="">
+  {{- if .Error}}
+  <span role="alert" class="error-msg" id="errormsg_0_Email">{{.Error}}</span>
+  {{- end}}
+  <input id="next" name="signIn" type="submit" value="Next">
+</form>
+</body>
+</html>
+`))
+
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in - Google Accounts</title></head>
+<body>
+<h1>Welcome</h1>
+<form novalidate method="post" action="/signin/challenge/sl/password" id="gaia_loginform">
+  <input name="Page" type="hidden" value="PasswordSeparationSignIn">
+  <input type="hidden" name="gxf" value="AFoagUVp4Cg">
+  <input type="hidden" name="continue" value="/o/saml2/continue">
+  <input id="Email-hidden" type="hidden" name="Email" value="{{.Email}}">
+  <input id="Passwd" name="Passwd" type="password" placeholder="Password">
+  {{- if .Error}}
+  <span role="alert" class="error-msg" id="errormsg_0_Passwd">{{.Error}}</span>
+  {{- end}}
+  {{- if .CAPTCHA}}
+  <div class="captcha-container">
+    <img src="{{.CAPTCHA}}" alt="Visual verification">
+    <input type="hidden" name="url" value="{{.CAPTCHA}}">
+    <input type="hidden" name="logintoken" value="captcha-token">
+    <input type="text" name="logincaptcha" placeholder="Type the text you hear or see">
+  </div>
+  {{- end}}
+  <input id="signIn" name="signIn" type="submit" value="Next">
+</form>
+</body>
+</html>
+`))
+
+var totpPage = template.Must(template.New("totp").Parse(`<!DOCTYPE html>
+<html>
+<head><title>2-Step Verification</title></head>
+<body>
+<h1>2-Step Verification</h1>
+<form id="challenge" method="post" action="/signin/challenge/totp/2">
+  <input type="hidden" name="challengeId" value="2">
+  <input type="hidden" name="challengeType" value="6">
+  <input type="hidden" name="continue" value="/o/saml2/continue">
+  <input type="hidden" name="TL" value="AM3QAYZ">
+  <input type="hidden" name="gxf" value="AFoagUVp4Cg">
+  <p>Get a verification code from the <strong>Google Authenticator</strong> app</p>
+  <input type="tel" name="Pin" id="totpPin" pattern="[0-9 ]*" placeholder="Enter code">
+  {{- if .Error}}
+  <span role="alert" class="error-msg" id="errormsg_0_Pin">{{.Error}}</span>
+  {{- end}}
+  <input type="checkbox" name="TrustDevice" id="trustDevice" checked>
+  <input type="submit" id="submit" value="Next">
+</form>
+{{- if .AnotherWay}}
+<form method="post" action="/signin/selectchallenge/2">
+  <input type="hidden" name="continue" value="/o/saml2/continue">
+  <input type="hidden" name="TL" value="AM3QAYZ">
+  <input type="hidden" name="Email" value="{{.Email}}">
+  <button type="submit">Try another way</button>
+</form>
+{{- end}}
+</body>
+</html>
+`))
+
+var promptPage = template.Must(template.New("prompt").Parse(`<!DOCTYPE html>
+<html>
+<head><title>2-Step Verification</title></head>
+<body>
+<h1>2-Step Verification</h1>
+<form id="challenge" method="post" action="/signin/challenge/az/3">
+  <input type="hidden" name="challengeId" value="3">
+  <input type="hidden" name="challengeType" value="39">
+  <input type="hidden" name="continue" value="/o/saml2/continue">
+  <input type="hidden" name="TL" value="AM3QAYZ">
+  <input type="hidden" name="gxf" value="AFoagUVp4Cg">
+  <input id="Email-hidden" type="hidden" name="Email" value="{{.Email}}">
+  <div data-tx-id="{{.TxID}}" data-api-key="{{.APIKey}}" data-gapi-url="{{.GAPIURL}}" data-tx-lifetime="120000">
+    <p>Google sent a notification to your phone. Tap <b>Yes</b> on the notification to continue.</p>
+  </div>
+</form>
+{{- if .AnotherWay}}
+<form method="post" action="/signin/selectchallenge/3">
+  <input type="hidden" name="continue" value="/o/saml2/continue">
+  <input type="hidden" name="TL" value="AM3QAYZ">
+  <input type="hidden" name="Email" value="{{.Email}}">
+  <button type="submit">Try another way</button>
+</form>
+{{- end}}
+</body>
+</html>
+`))
+
+// challengeList lists the challenges offered to a user.
+type challengeList struct {
+	Email  string
+	Prompt bool
+	TOTP   bool
+}
+
+var challengeListPage = template.Must(template.New("challenges").Parse(`<!DOCTYPE html>
+<html>
+<head><title>2-Step Verification</title></head>
+<body>
+<h1>Choose how you want to sign in:</h1>
+<ol id="challengePickerList">
+  {{- if .Prompt}}
+  <li>
+    <form method="post" action="/signin/challenge/az/3">
+      <input type="hidden" name="challengeId" value="3">
+      <input type="hidden" name="challengeType" value="39">
+      <input type="hidden" name="Email" value="{{.Email}}">
+      <button type="submit">Get a Google prompt on your phone</button>
+    </form>
+  </li>
+  {{- end}}
+  {{- if .TOTP}}
+  <li>
+    <form method="post" action="/signin/challenge/totp/2">
+      <input type="hidden" name="challengeId" value="2">
+      <input type="hidden" name="challengeType" value="6">
+      <input type="hidden" name="Email" value="{{.Email}}">
+      <button type="submit">Get a verification code from the <b>Google Authenticator</b> app</button>
+    </form>
+  </li>
+  {{- end}}
+  <li>
+    <form method="post" action="/signin/challenge/sk/5">
+      <input type="hidden" name="challengeId" value="5">
+      <input type="hidden" name="challengeType" value="2">
+      <input type="hidden" name="Email" value="{{.Email}}">
+      <button type="submit">Use your security key</button>
+    </form>
+  </li>
+</ol>
+</body>
+</html>
+`))
+
+var samlPage = template.Must(template.New("saml").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Redirecting</title></head>
+<body onload="document.forms[0].submit()">
+<form action="{{.Action}}" method="post">
+  <input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+  <noscript><input type="submit" value="Continue"></noscript>
+</form>
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Error</title></head>
+<body>
+<div id="af-error-container">
+  <p><b>403.</b> <ins>That’s an error.</ins></p>
+  <p>{{.}}</p>
+</div>
+</body>
+</html>
+`))
+
+var rolePickerPage = template.Must(template.New("roles").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Amazon Web Services Sign-In</title></head>
+<body>
+<form id="saml_form" name="saml_form" action="/saml" method="post">
+  <p>Select a role:</p>
+  <fieldset>
+  {{- range .}}
+    <div class="saml-account">
+      <div class="expandable-container">
+        <div class="saml-account-name">Account: {{if .Alias}}{{.Alias}} ({{.ID}}){{else}}{{.ID}}{{end}}</div>
+      </div>
+      <hr style="border: 1px solid #ddd;">
+      <div class="saml-account" id="{{.ID}}">
+      {{- range .Roles}}
+        <div class="saml-role">
+          <input type="radio" name="roleIndex" value="{{.ARN}}" class="saml-radio" id="{{.ARN}}">
+          <label for="{{.ARN}}" class="saml-role-description">{{.Name}}</label>
+          <span style="clear: both;"></span>
+        </div>
+      {{- end}}
+      </div>
+    </div>
+  {{- end}}
+  </fieldset>
+</form>
+</body>
+</html>
+`))
+
+const metadata = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://accounts.google.com/o/saml2?idpid=%s" validUntil="2030-01-01T00:00:00.000Z">
+  <md:IDPSSODescriptor WantAuthnRequestsSigned="false" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data>
+          <ds:X509Certificate>%s</ds:X509Certificate>
+        </ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified</md:NameIDFormat>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="%s/o/saml2/idp?idpid=%s"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>
+`
@@ -0,0 +1,467 @@
+// Package samltest provides a fake Google IdP and AWS sign-in page serving the
+// markup the saml package scrapes, for use in end-to-end tests.
+package samltest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/talos-systems/go-gsuite/saml"
+)
+
+// DefaultProvider is the name of the SAML provider of the roles that do not
+// set one.
+const DefaultProvider = "GoogleApps"
+
+// Role is an AWS role granted to a user.
+type Role struct {
+	AccountID    string
+	AccountAlias string
+	Name         string
+	Provider     string
+	// MaxSessionDuration is the longest session STS grants for the role, in
+	// seconds. It defaults to one hour, like in AWS.
+	MaxSessionDuration int
+}
+
+// ARN returns the ARN of the role.
+func (r Role) ARN() string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", r.AccountID, r.Name)
+}
+
+// PrincipalARN returns the ARN of the SAML provider of the role.
+func (r Role) PrincipalARN() string {
+	provider := r.Provider
+	if provider == "" {
+		provider = DefaultProvider
+	}
+
+	return fmt.Sprintf("arn:aws:iam::%s:saml-provider/%s", r.AccountID, provider)
+}
+
+// PromptAnswer is how the user responds to the phone prompt.
+type PromptAnswer string
+
+const (
+	// PromptApprove taps Yes on the prompt.
+	PromptApprove PromptAnswer = "approve"
+	// PromptDeny taps No on the prompt.
+	PromptDeny PromptAnswer = "deny"
+	// PromptIgnore never responds to the prompt.
+	PromptIgnore PromptAnswer = "ignore"
+)
+
+// APIKey is the key the phone prompt transaction is polled with.
+const APIKey = "samltest-api-key"
+
+// User is an account of the fake IdP.
+type User struct {
+	Email    string
+	Password string
+	// TOTPSecret enables 2-step verification with an authenticator app when
+	// set.
+	TOTPSecret string
+	// Prompt enables 2-step verification with the phone prompt when set,
+	// which is then answered as specified. The prompt is asked for before
+	// the authenticator app.
+	Prompt PromptAnswer
+	// CAPTCHA is the solution of a CAPTCHA asked for after the password when
+	// set.
+	CAPTCHA string
+	// SessionDuration is asserted in seconds when set.
+	SessionDuration int
+	Roles           []Role
+
+	// SourceIdentity, PrincipalTags and TransitiveTagKeys are asserted when
+	// set.
+	SourceIdentity    string
+	PrincipalTags     map[string]string
+	TransitiveTagKeys []string
+}
+
+// Server is a fake Google IdP and AWS sign-in page.
+type Server struct {
+	*httptest.Server
+
+	IdPID string
+	SPID  string
+
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+
+	mu          sync.Mutex
+	users       map[string]User
+	responses   map[string]string
+	sessions    map[string]session
+	assumeRoles []AssumeRoleRequest
+	prompts     map[string]string
+	approved    map[string]bool
+}
+
+// NewServer starts and returns a new Server for the SAML app identified by
+// idpid and spid. The assertions are signed with a key generated for the
+// server. The caller should call Close when finished.
+func NewServer(idpid, spid string, users ...User) *Server {
+	key, cert, err := newKeyPair(idpid)
+	if err != nil {
+		panic(fmt.Sprintf("samltest: failed to generate a signing key: %v", err))
+	}
+
+	s := &Server{
+		IdPID:     idpid,
+		SPID:      spid,
+		key:       key,
+		cert:      cert,
+		users:     map[string]User{},
+		responses: map[string]string{},
+		sessions:  map[string]session{},
+		prompts:   map[string]string{},
+		approved:  map[string]bool{},
+	}
+
+	for _, u := range users {
+		s.users[u.Email] = u
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/o/saml2/initsso", s.initSSO)
+	mux.HandleFunc("/ServiceLogin", s.serviceLogin)
+	mux.HandleFunc("/signin/v1/lookup", s.lookup)
+	mux.HandleFunc("/signin/challenge/sl/password", s.password)
+	mux.HandleFunc("/signin/challenge/totp/2", s.totp)
+	mux.HandleFunc("/signin/challenge/az/3", s.prompt)
+	mux.HandleFunc("/signin/selectchallenge/", s.selectChallenge)
+	mux.HandleFunc("/cryptauth/v1/authzen/awaittx", s.awaitTx)
+	mux.HandleFunc("/saml", s.awsSignIn)
+	mux.HandleFunc("/sts/", s.sts)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AccountsURL returns the URL to pass to saml.WithAccountsURL.
+func (s *Server) AccountsURL() string {
+	return s.URL
+}
+
+// AWSSignInURL returns the URL the SAMLResponse is posted to.
+func (s *Server) AWSSignInURL() string {
+	return s.URL + "/saml"
+}
+
+// Certificate returns the certificate the assertions are signed with.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// CertificatePEM returns the PEM encoded signing certificate.
+func (s *Server) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.cert.Raw})
+}
+
+// Metadata returns the IdP metadata XML, as downloaded from the Google Admin
+// console.
+func (s *Server) Metadata() []byte {
+	return []byte(fmt.Sprintf(metadata, s.IdPID, base64.StdEncoding.EncodeToString(s.cert.Raw), s.URL, s.IdPID))
+}
+
+// STSURL returns the URL to pass to saml.WithSTSEndpoint.
+func (s *Server) STSURL() string {
+	return s.URL + "/sts"
+}
+
+// SAMLResponse returns the last SAMLResponse issued to email.
+func (s *Server) SAMLResponse(email string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.responses[email]
+}
+
+// newKeyPair returns a key and a self-signed certificate like the ones
+// Google generates for a SAML app.
+func newKeyPair(idpid string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject: pkix.Name{
+			CommonName:         "Google",
+			OrganizationalUnit: []string{"Google For Work"},
+			Organization:       []string{"Google Inc."},
+		},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(24 * time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, cert, nil
+}
+
+func (s *Server) user(email string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[email]
+
+	return u, ok
+}
+
+func (s *Server) initSSO(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("idpid") != s.IdPID || q.Get("spid") != s.SPID {
+		w.WriteHeader(http.StatusForbidden)
+		render(w, errorPage, "Error: app_not_configured_for_user")
+
+		return
+	}
+
+	http.Redirect(w, r, "/ServiceLogin?"+url.Values{"continue": {s.URL + "/o/saml2/continue"}}.Encode(), http.StatusFound)
+}
+
+func (s *Server) serviceLogin(w http.ResponseWriter, r *http.Request) {
+	render(w, emailPage, page{})
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) {
+	email := r.PostFormValue("Email")
+
+	if _, ok := s.user(email); !ok {
+		render(w, emailPage, page{Error: "Couldn't find your Google Account"})
+
+		return
+	}
+
+	render(w, passwordPage, page{Email: email})
+}
+
+func (s *Server) password(w http.ResponseWriter, r *http.Request) {
+	email := r.PostFormValue("Email")
+
+	u, ok := s.user(email)
+	if !ok || r.PostFormValue("Passwd") != u.Password {
+		render(w, passwordPage, page{Email: email, Error: "Wrong password. Try again or click Forgot password to reset it."})
+
+		return
+	}
+
+	if u.CAPTCHA != "" && r.PostFormValue("logincaptcha") != u.CAPTCHA {
+		p := page{Email: email, CAPTCHA: s.URL + "/Captcha?ctoken=" + url.QueryEscape(email)}
+		if r.PostFormValue("logincaptcha") != "" {
+			p.Error = "Please re-enter the characters you see in the image above."
+		}
+
+		render(w, passwordPage, p)
+
+		return
+	}
+
+	switch {
+	case u.Prompt != "":
+		s.promptChallenge(w, u)
+	case u.TOTPSecret != "":
+		render(w, totpPage, page{Email: email, AnotherWay: anotherWay(u)})
+	default:
+		s.samlResponse(w, u)
+	}
+}
+
+func (s *Server) totp(w http.ResponseWriter, r *http.Request) {
+	email := r.PostFormValue("Email")
+
+	u, ok := s.user(email)
+	if !ok || u.TOTPSecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	// The challenge was selected from the "Try another way" page.
+	if _, ok := r.PostForm["Pin"]; !ok {
+		render(w, totpPage, page{Email: email, AnotherWay: anotherWay(u)})
+
+		return
+	}
+
+	if !validTOTP(u.TOTPSecret, r.PostFormValue("Pin")) {
+		render(w, totpPage, page{Email: email, Error: "Wrong code. Try again.", AnotherWay: anotherWay(u)})
+
+		return
+	}
+
+	s.samlResponse(w, u)
+}
+
+// promptChallenge sends a phone prompt to u and renders the page waiting for
+// it.
+func (s *Server) promptChallenge(w http.ResponseWriter, u User) {
+	tx := randomHex(8)
+
+	s.mu.Lock()
+	s.prompts[tx] = u.Email
+	s.mu.Unlock()
+
+	render(w, promptPage, page{Email: u.Email, AnotherWay: anotherWay(u), TxID: tx, APIKey: APIKey, GAPIURL: s.URL})
+}
+
+// anotherWay reports whether u has more than one second factor to choose
+// from.
+func anotherWay(u User) bool {
+	return u.Prompt != "" && u.TOTPSecret != ""
+}
+
+// selectChallenge renders the "Try another way" page.
+func (s *Server) selectChallenge(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.user(r.PostFormValue("Email"))
+	if !ok || !anotherWay(u) {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	render(w, challengeListPage, challengeList{Email: u.Email, Prompt: u.Prompt != "", TOTP: u.TOTPSecret != ""})
+}
+
+// prompt completes the phone prompt challenge once the prompt is approved,
+// and sends a new prompt otherwise.
+func (s *Server) prompt(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.user(r.PostFormValue("Email"))
+	if !ok || u.Prompt == "" {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	s.mu.Lock()
+	approved := s.approved[u.Email]
+	delete(s.approved, u.Email)
+	s.mu.Unlock()
+
+	if !approved {
+		s.promptChallenge(w, u)
+
+		return
+	}
+
+	s.samlResponse(w, u)
+}
+
+// awaitTx answers the long poll of a phone prompt transaction.
+func (s *Server) awaitTx(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TxID string `json:"txId"`
+	}
+
+	if r.URL.Query().Get("key") != APIKey || json.NewDecoder(r.Body).Decode(&body) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, ok := s.prompts[body.TxID]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	switch s.users[email].Prompt {
+	case PromptApprove:
+		s.approved[email] = true
+	case PromptIgnore:
+		w.WriteHeader(http.StatusRequestTimeout)
+
+		return
+	}
+
+	delete(s.prompts, body.TxID)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, "{}")
+}
+
+func (s *Server) samlResponse(w http.ResponseWriter, u User) {
+	response, err := s.assertion(u, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(response)
+
+	s.mu.Lock()
+	s.responses[u.Email] = encoded
+	s.mu.Unlock()
+
+	render(w, samlPage, page{Action: s.AWSSignInURL(), SAMLResponse: encoded})
+}
+
+func (s *Server) awsSignIn(w http.ResponseWriter, r *http.Request) {
+	encoded := r.PostFormValue("SAMLResponse")
+
+	s.mu.Lock()
+	var user User
+	found := false
+	for email, response := range s.responses {
+		if response == encoded {
+			user, found = s.users[email]
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		w.WriteHeader(http.StatusBadRequest)
+		render(w, errorPage, "Your request included an invalid SAML response.")
+
+		return
+	}
+
+	render(w, rolePickerPage, accounts(user.Roles))
+}
+
+// validTOTP accepts the codes of the current and the adjacent time steps.
+func validTOTP(secret, pin string) bool {
+	t := &saml.TOTP{Secret: secret}
+	now := time.Now()
+
+	for _, skew := range []time.Duration{0, -30 * time.Second, 30 * time.Second} {
+		if code, err := t.Generate(now.Add(skew)); err == nil && code == pin {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,324 @@
+package samltest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+const stsNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+type stsCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+type stsAssumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleID string `xml:"AssumedRoleId"`
+}
+
+type assumeRoleWithSAMLResponse struct {
+	XMLName         xml.Name           `xml:"AssumeRoleWithSAMLResponse"`
+	Xmlns           string             `xml:"xmlns,attr"`
+	Credentials     stsCredentials     `xml:"AssumeRoleWithSAMLResult>Credentials"`
+	AssumedRoleUser stsAssumedRoleUser `xml:"AssumeRoleWithSAMLResult>AssumedRoleUser"`
+	Subject         string             `xml:"AssumeRoleWithSAMLResult>Subject"`
+	RequestID       string             `xml:"ResponseMetadata>RequestId"`
+}
+
+type assumeRoleResponse struct {
+	XMLName         xml.Name           `xml:"AssumeRoleResponse"`
+	Xmlns           string             `xml:"xmlns,attr"`
+	Credentials     stsCredentials     `xml:"AssumeRoleResult>Credentials"`
+	AssumedRoleUser stsAssumedRoleUser `xml:"AssumeRoleResult>AssumedRoleUser"`
+	RequestID       string             `xml:"ResponseMetadata>RequestId"`
+}
+
+type stsErrorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Xmlns     string   `xml:"xmlns,attr"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func stsError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+
+	xml.NewEncoder(w).Encode(stsErrorResponse{
+		Xmlns:     stsNamespace,
+		Type:      "Sender",
+		Code:      code,
+		Message:   message,
+		RequestID: randomHex(16),
+	})
+}
+
+func stsRespond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+// sts is a fake of the STS API.
+func (s *Server) sts(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		stsError(w, http.StatusBadRequest, "InvalidParameterValue", err.Error())
+
+		return
+	}
+
+	switch action := r.PostForm.Get("Action"); action {
+	case "AssumeRoleWithSAML":
+		s.assumeRoleWithSAML(w, r)
+	case "AssumeRole":
+		s.assumeRole(w, r)
+	default:
+		stsError(w, http.StatusBadRequest, "InvalidAction", "Could not find operation "+action)
+	}
+}
+
+// sessionDuration returns the DurationSeconds of the request, or writes an
+// error when it is not within the limits of role.
+func sessionDuration(w http.ResponseWriter, r *http.Request, role Role) (time.Duration, bool) {
+	seconds := 3600
+
+	if v := r.PostForm.Get("DurationSeconds"); v != "" {
+		var err error
+		if seconds, err = strconv.Atoi(v); err != nil || seconds < 900 {
+			stsError(w, http.StatusBadRequest, "ValidationError", "1 validation error detected: Value '"+v+"' at 'durationSeconds' failed to satisfy constraint: Member must have value greater than or equal to 900")
+
+			return 0, false
+		}
+	}
+
+	max := role.MaxSessionDuration
+	if max == 0 {
+		max = 3600
+	}
+
+	if seconds > max {
+		stsError(w, http.StatusBadRequest, "ValidationError", "The requested DurationSeconds exceeds the MaxSessionDuration set for this role.")
+
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+func (s *Server) assumeRoleWithSAML(w http.ResponseWriter, r *http.Request) {
+	assertion := r.PostForm.Get("SAMLAssertion")
+
+	var (
+		u     User
+		found bool
+	)
+
+	s.mu.Lock()
+	for email, response := range s.responses {
+		if response == assertion {
+			u, found = s.users[email]
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		stsError(w, http.StatusBadRequest, "InvalidIdentityToken", "Invalid SAML assertion")
+
+		return
+	}
+
+	roleARN, principalARN := r.PostForm.Get("RoleArn"), r.PostForm.Get("PrincipalArn")
+
+	var role *Role
+
+	for i := range u.Roles {
+		if u.Roles[i].ARN() == roleARN && u.Roles[i].PrincipalARN() == principalARN {
+			role = &u.Roles[i]
+		}
+	}
+
+	if role == nil {
+		stsError(w, http.StatusForbidden, "AccessDenied", "Not authorized to perform sts:AssumeRoleWithSAML")
+
+		return
+	}
+
+	duration, ok := sessionDuration(w, r, *role)
+	if !ok {
+		return
+	}
+
+	// The SessionDuration attribute caps the session.
+	if asserted := time.Duration(u.SessionDuration) * time.Second; asserted > 0 && asserted < duration {
+		duration = asserted
+	}
+
+	user := assumedRoleUser(role.AccountID, role.Name, u.Email)
+
+	stsRespond(w, assumeRoleWithSAMLResponse{
+		Xmlns:           stsNamespace,
+		Credentials:     s.credentials(user.Arn, duration),
+		AssumedRoleUser: user,
+		Subject:         u.Email,
+		RequestID:       randomHex(16),
+	})
+}
+
+// AssumeRoleRequest is an sts:AssumeRole request received by the fake STS.
+type AssumeRoleRequest struct {
+	// CallerARN is the ARN of the session that signed the request.
+	CallerARN       string
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	SerialNumber    string
+	TokenCode       string
+	DurationSeconds int
+
+	SourceIdentity    string
+	Tags              map[string]string
+	TransitiveTagKeys []string
+}
+
+// AssumeRoleRequests returns the sts:AssumeRole requests received so far.
+func (s *Server) AssumeRoleRequests() []AssumeRoleRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]AssumeRoleRequest(nil), s.assumeRoles...)
+}
+
+// session is a session issued by the fake STS.
+type session struct {
+	arn   string
+	token string
+}
+
+// caller returns the session that signed r.
+func (s *Server) caller(r *http.Request) (session, bool) {
+	// Authorization: AWS4-HMAC-SHA256 Credential=<key>/<scope>, ...
+	auth := r.Header.Get("Authorization")
+
+	i := strings.Index(auth, "Credential=")
+	if i < 0 {
+		return session{}, false
+	}
+
+	key := auth[i+len("Credential="):]
+	if j := strings.Index(key, "/"); j >= 0 {
+		key = key[:j]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, ok := s.sessions[key]
+	if !ok || issued.token != r.Header.Get("X-Amz-Security-Token") {
+		return session{}, false
+	}
+
+	return issued, true
+}
+
+func (s *Server) assumeRole(w http.ResponseWriter, r *http.Request) {
+	caller, ok := s.caller(r)
+	if !ok {
+		stsError(w, http.StatusForbidden, "InvalidClientTokenId", "The security token included in the request is invalid.")
+
+		return
+	}
+
+	req := AssumeRoleRequest{
+		CallerARN:       caller.arn,
+		RoleARN:         r.PostForm.Get("RoleArn"),
+		RoleSessionName: r.PostForm.Get("RoleSessionName"),
+		ExternalID:      r.PostForm.Get("ExternalId"),
+		SerialNumber:    r.PostForm.Get("SerialNumber"),
+		TokenCode:       r.PostForm.Get("TokenCode"),
+	}
+
+	req.DurationSeconds, _ = strconv.Atoi(r.PostForm.Get("DurationSeconds"))
+	req.SourceIdentity = r.PostForm.Get("SourceIdentity")
+
+	for i := 1; r.PostForm.Get(fmt.Sprintf("Tags.member.%d.Key", i)) != ""; i++ {
+		if req.Tags == nil {
+			req.Tags = map[string]string{}
+		}
+
+		req.Tags[r.PostForm.Get(fmt.Sprintf("Tags.member.%d.Key", i))] = r.PostForm.Get(fmt.Sprintf("Tags.member.%d.Value", i))
+	}
+
+	for i := 1; r.PostForm.Get(fmt.Sprintf("TransitiveTagKeys.member.%d", i)) != ""; i++ {
+		req.TransitiveTagKeys = append(req.TransitiveTagKeys, r.PostForm.Get(fmt.Sprintf("TransitiveTagKeys.member.%d", i)))
+	}
+
+	parsed, err := arn.Parse(req.RoleARN)
+	if err != nil || !strings.HasPrefix(parsed.Resource, "role/") || req.RoleSessionName == "" {
+		stsError(w, http.StatusBadRequest, "ValidationError", "Invalid AssumeRole request")
+
+		return
+	}
+
+	// Role chaining limits the session to one hour.
+	duration, ok := sessionDuration(w, r, Role{MaxSessionDuration: 3600})
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.assumeRoles = append(s.assumeRoles, req)
+	s.mu.Unlock()
+
+	user := assumedRoleUser(parsed.AccountID, parsed.Resource[strings.LastIndex(parsed.Resource, "/")+1:], req.RoleSessionName)
+
+	stsRespond(w, assumeRoleResponse{
+		Xmlns:           stsNamespace,
+		Credentials:     s.credentials(user.Arn, duration),
+		AssumedRoleUser: user,
+		RequestID:       randomHex(16),
+	})
+}
+
+func assumedRoleUser(accountID, role, sessionName string) stsAssumedRoleUser {
+	return stsAssumedRoleUser{
+		Arn:           "arn:aws:sts::" + accountID + ":assumed-role/" + role + "/" + sessionName,
+		AssumedRoleID: "AROA" + strings.ToUpper(randomHex(8)) + ":" + sessionName,
+	}
+}
+
+// credentials issues credentials for the session arn.
+func (s *Server) credentials(arn string, duration time.Duration) stsCredentials {
+	c := stsCredentials{
+		AccessKeyID:     "ASIA" + strings.ToUpper(randomHex(8)),
+		SecretAccessKey: randomHex(20),
+		SessionToken:    randomHex(32),
+		Expiration:      time.Now().Add(duration).UTC().Format(time.RFC3339),
+	}
+
+	s.mu.Lock()
+	s.sessions[c.AccessKeyID] = session{arn: arn, token: c.SessionToken}
+	s.mu.Unlock()
+
+	return c
+}
@@ -3,6 +3,7 @@ package saml
 import (
 	"errors"
 	"net/url"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aws/aws-sdk-go/aws/arn"
@@ -28,6 +29,37 @@ func scrapeFormValues(doc *goquery.Document) (v url.Values) {
 	return v
 }
 
+// challengeValues are the inputs of a challenge page that have to be posted
+// back with the response to the challenge.
+var challengeValues = []string{"TL", "continue", "scc", "sarp", "gxf"}
+
+func scrapeChallengeValues(doc *goquery.Document, v url.Values) {
+	// TODO(andrewrynhard): How can we scrape these automatically?
+	for _, name := range challengeValues {
+		value, _ := doc.Find("input[name=" + name + "]").Attr("value")
+		v[name] = []string{value}
+	}
+}
+
+func scrapeHiddenValues(form *goquery.Selection) (v url.Values) {
+	v = url.Values{}
+	form.Find("input[type=hidden]").Each(func(i int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		if name == "" {
+			return
+		}
+		value, _ := s.Attr("value")
+		v[name] = []string{value}
+	})
+
+	return v
+}
+
+// scrapeHeading returns the main heading of a page.
+func scrapeHeading(doc *goquery.Document) string {
+	return strings.Join(strings.Fields(doc.Find("h1").First().Text()), " ")
+}
+
 func scrapeFormAction(doc *goquery.Document) (formAction string, err error) {
 	formAction, found := doc.Find("#gaia_loginform").Attr("action")
 	if !found {
@@ -46,6 +78,64 @@ func scrapeFormActionF(doc *goquery.Document) (formAction string, err error) {
 	return formAction, nil
 }
 
+// scrapeChallengeAction returns the action of the first challenge form in doc.
+func scrapeChallengeAction(doc *goquery.Document) (formAction string, err error) {
+	doc.Find("form[action]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		action, _ := s.Attr("action")
+		if challengePath.MatchString(action) {
+			formAction = action
+			return false
+		}
+		return true
+	})
+
+	if formAction == "" {
+		return "", errors.New("failed to find challenge form action")
+	}
+
+	return formAction, nil
+}
+
+// isChallengeList reports whether doc is the "Try another way" page.
+func isChallengeList(doc *goquery.Document) bool {
+	return doc.Find("#challengePickerList").Length() > 0
+}
+
+func scrapeChallenges(doc *goquery.Document) (challenges []Challenge) {
+	doc.Find("#challengePickerList form[action]").Each(func(i int, s *goquery.Selection) {
+		action, _ := s.Attr("action")
+		t, id, ok := parseChallenge(action)
+		if !ok {
+			return
+		}
+
+		if method, _ := s.Find("input[name=SendMethod]").Attr("value"); t == ChallengeSMS && method == sendMethodVoice {
+			t = ChallengeVoice
+		}
+
+		challenges = append(challenges, Challenge{
+			Type:        t,
+			ID:          id,
+			Description: strings.Join(strings.Fields(s.Text()), " "),
+			form:        s,
+		})
+	})
+
+	return challenges
+}
+
+// scrapeErrorMessage returns the error message rendered next to the input of
+// a form.
+func scrapeErrorMessage(doc *goquery.Document) string {
+	return strings.Join(strings.Fields(doc.Find(".error-msg, [id^=errormsg_], [role=alert]").First().Text()), " ")
+}
+
+// backupCodeUsed reports whether doc rejects a backup code that has already
+// been used.
+func backupCodeUsed(doc *goquery.Document) bool {
+	return errorFromMessage(scrapeErrorMessage(doc)) == ErrBackupCodeUsed
+}
+
 func scrapeSAMLResponse(doc *goquery.Document) (SAMLResponse string, err error) {
 	SAMLResponse, found := doc.Find("input[name='SAMLResponse']").Attr("value")
 	if !found {
@@ -55,11 +145,26 @@ func scrapeSAMLResponse(doc *goquery.Document) (SAMLResponse string, err error)
 	return SAMLResponse, nil
 }
 
-func scrapeAWSInfo(doc *goquery.Document) (accounts []Account, err error) {
-	accounts = []Account{}
+func scrapeSAMLAction(doc *goquery.Document) (formAction string, err error) {
+	formAction, found := doc.Find("input[name='SAMLResponse']").Closest("form").Attr("action")
+	if !found {
+		return "", errors.New("failed to find SAMLResponse form action")
+	}
+
+	return formAction, nil
+}
+
+// scrapeErrorPage returns the message of a Google error page.
+func scrapeErrorPage(doc *goquery.Document) string {
+	return strings.Join(strings.Fields(doc.Find("#af-error-container").Text()), " ")
+}
+
+func scrapeAWSInfo(doc *goquery.Document) (accounts Accounts, err error) {
+	accounts = Accounts{}
 	doc.Find("fieldset > div.saml-account").Each(func(i int, s *goquery.Selection) {
-		name := s.Find("div.saml-account-name").Text()
+		name := strings.TrimSpace(s.Find("div.saml-account-name").Text())
 		account := Account{Name: name}
+		account.Alias, account.ID, _ = parseAccountName(name)
 		s.Find("label").Each(func(i int, s *goquery.Selection) {
 			a, _ := s.Attr("for")
 			parsed, err := arn.Parse(a)
@@ -67,11 +172,15 @@ func scrapeAWSInfo(doc *goquery.Document) (accounts []Account, err error) {
 				return
 			}
 			role := Role{
-				Name: s.Text(),
-				ARN:  &parsed,
+				Name:      roleName(parsed),
+				ARN:       &parsed,
+				AccountID: parsed.AccountID,
 			}
 			account.Roles = append(account.Roles, role)
 		})
+		if account.ID == "" && len(account.Roles) > 0 {
+			account.ID = account.Roles[0].AccountID
+		}
 		accounts = append(accounts, account)
 	})
 
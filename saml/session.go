@@ -0,0 +1,130 @@
+package saml
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// maxSessionNameLength is the longest RoleSessionName and SourceIdentity
+// accepted by STS.
+const maxSessionNameLength = 64
+
+// invalidSessionNameChars matches the characters STS rejects in a
+// RoleSessionName or a SourceIdentity.
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// SessionData is the data available to the RoleSessionName and
+// SourceIdentity templates.
+type SessionData struct {
+	// Email is the email of the user, as asserted by Google.
+	Email string
+	// User is the local part of Email.
+	User string
+	// Domain is the domain of Email.
+	Domain string
+	// RoleSessionName is the RoleSessionName asserted by Google.
+	RoleSessionName string
+}
+
+// sessionData returns the data of the templates for the assertion a.
+func sessionData(a *Assertion) SessionData {
+	email := a.Subject
+	if email == "" {
+		email = a.RoleSessionName
+	}
+
+	d := SessionData{
+		Email:           email,
+		User:            email,
+		RoleSessionName: a.RoleSessionName,
+	}
+
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		d.User, d.Domain = email[:i], email[i+1:]
+	}
+
+	return d
+}
+
+// parseSessionTemplate parses the template of a RoleSessionName or a
+// SourceIdentity.
+func parseSessionTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s template", name)
+	}
+
+	return t, nil
+}
+
+// executeSessionTemplate renders t with d and replaces the characters STS
+// rejects.
+func executeSessionTemplate(t *template.Template, d SessionData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return "", errors.Wrapf(err, "failed to render %s", t.Name())
+	}
+
+	value := invalidSessionNameChars.ReplaceAllString(buf.String(), "-")
+	if len(value) > maxSessionNameLength {
+		value = value[:maxSessionNameLength]
+	}
+
+	if len(value) < 2 {
+		return "", errors.Errorf("%s %q is shorter than 2 characters", t.Name(), value)
+	}
+
+	return value, nil
+}
+
+// applySession sets the RoleSessionName, the SourceIdentity and the session
+// tags configured by the options on input.
+func (g *GSuite) applySession(input *sts.AssumeRoleInput) error {
+	d := sessionData(g.assertion)
+
+	if input.RoleSessionName == nil {
+		name := d.RoleSessionName
+
+		if g.roleSessionName != nil {
+			var err error
+			if name, err = executeSessionTemplate(g.roleSessionName, d); err != nil {
+				return err
+			}
+		}
+
+		input.RoleSessionName = aws.String(name)
+	}
+
+	if g.sourceIdentity != nil {
+		identity, err := executeSessionTemplate(g.sourceIdentity, d)
+		if err != nil {
+			return err
+		}
+
+		input.SourceIdentity = aws.String(identity)
+	}
+
+	keys := make([]string, 0, len(g.sessionTags))
+	for key := range g.sessionTags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		input.Tags = append(input.Tags, &sts.Tag{Key: aws.String(key), Value: aws.String(g.sessionTags[key])})
+
+		if g.transitiveTags[key] {
+			input.TransitiveTagKeys = append(input.TransitiveTagKeys, aws.String(key))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package saml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecuteSessionTemplate(t *testing.T) {
+	d := sessionData(&Assertion{Subject: "jane.doe@example.com", RoleSessionName: "jane.doe@example.com"})
+
+	if d.User != "jane.doe" || d.Domain != "example.com" {
+		t.Errorf("unexpected session data %+v", d)
+	}
+
+	for _, tc := range []struct {
+		template string
+		expected string
+		err      bool
+	}{
+		{"{{.Email}}", "jane.doe@example.com", false},
+		{"{{.User}}/{{.Domain}}", "jane.doe-example.com", false},
+		{"ci {{.User}}", "ci-jane.doe", false},
+		{strings.Repeat("x", 70), strings.Repeat("x", 64), false},
+		{"x", "", true},
+		{"{{.Missing}}", "", true},
+	} {
+		tmpl, err := parseSessionTemplate("RoleSessionName", tc.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := executeSessionTemplate(tmpl, d)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tc.template, value)
+			}
+
+			continue
+		}
+
+		if err != nil || value != tc.expected {
+			t.Errorf("%q: expected %q, got %q, %v", tc.template, tc.expected, value, err)
+		}
+	}
+
+	if err := WithRoleSessionName("{{.User")(&settings{}); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,123 @@
+package saml
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+)
+
+// maxSessionDuration is the longest session AWS grants to a role.
+const maxSessionDuration = 12 * time.Hour
+
+// sessionDurationSteps are the durations tried, longest first, when STS
+// refuses a longer session.
+var sessionDurationSteps = []time.Duration{12 * time.Hour, 8 * time.Hour, 4 * time.Hour, time.Hour}
+
+// stsClient returns the STS client used to exchange the assertion. It uses
+// the HTTP client of the login, so that proxies and transports apply to STS
+// as well.
+func (g *GSuite) stsClient() (stsiface.STSAPI, error) {
+	if g.sts != nil {
+		return g.sts, nil
+	}
+
+	svc, err := g.newSTSClient(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g.sts = svc
+
+	return svc, nil
+}
+
+// newSTSClient returns an STS client signing its requests with creds, for
+// the calls that require credentials such as sts:AssumeRole.
+func (g *GSuite) newSTSClient(creds *credentials.Credentials) (stsiface.STSAPI, error) {
+	region, endpoint, err := g.stsEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := aws.NewConfig().WithRegion(region).WithHTTPClient(g.Client)
+	if endpoint != "" {
+		cfg = cfg.WithEndpoint(endpoint)
+	}
+
+	if creds != nil {
+		cfg = cfg.WithCredentials(creds)
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create AWS session")
+	}
+
+	return sts.New(sess), nil
+}
+
+// RetrieveMaxDurationCredentials gets the STS credentials of the role
+// identified by roleARN for the longest session available, and returns the
+// granted duration in seconds. See RetrieveMaxDurationCredentialsContext.
+func (g *GSuite) RetrieveMaxDurationCredentials(roleARN string) (*sts.AssumeRoleWithSAMLOutput, int64, error) {
+	return g.RetrieveMaxDurationCredentialsContext(context.Background(), roleARN)
+}
+
+// RetrieveMaxDurationCredentialsContext requests the SessionDuration asserted
+// by the IdP, or 12 hours when there is none. Each time STS refuses the
+// duration because it exceeds the MaxSessionDuration of the role, the next
+// shorter duration of 12, 8, 4 and 1 hours is requested.
+func (g *GSuite) RetrieveMaxDurationCredentialsContext(ctx context.Context, roleARN string) (o *sts.AssumeRoleWithSAMLOutput, granted int64, err error) {
+	if g.assertion == nil {
+		return nil, 0, ErrNoAssertion
+	}
+
+	for _, d := range sessionDurations(g.assertion.SessionDuration) {
+		granted = int64(d / time.Second)
+
+		o, err = g.RetrieveRoleCredentialsContext(ctx, roleARN, granted)
+		if err == nil {
+			return o, granted, nil
+		}
+
+		if !durationExceeded(err) {
+			return nil, 0, err
+		}
+	}
+
+	return nil, 0, errors.Wrapf(err, "no session duration down to %s was granted", time.Duration(granted)*time.Second)
+}
+
+// sessionDurations returns the durations to request, longest first, for the
+// SessionDuration asserted by the IdP.
+func sessionDurations(asserted time.Duration) []time.Duration {
+	longest := maxSessionDuration
+	if asserted > 0 && asserted < longest {
+		longest = asserted
+	}
+
+	durations := []time.Duration{longest}
+
+	for _, d := range sessionDurationSteps {
+		if d < longest {
+			durations = append(durations, d)
+		}
+	}
+
+	return durations
+}
+
+// durationExceeded reports whether STS refused the requested DurationSeconds.
+func durationExceeded(err error) bool {
+	aerr, ok := errors.Cause(err).(awserr.Error)
+
+	return ok && aerr.Code() == "ValidationError" && strings.Contains(aerr.Message(), "DurationSeconds exceeds")
+}
@@ -0,0 +1,106 @@
+package saml
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// fakeSTS grants sessions of up to max seconds.
+type fakeSTS struct {
+	stsiface.STSAPI
+
+	max       int64
+	requested []int64
+	inputs    []*sts.AssumeRoleWithSAMLInput
+}
+
+func (f *fakeSTS) AssumeRoleWithSAMLWithContext(ctx aws.Context, input *sts.AssumeRoleWithSAMLInput, opts ...request.Option) (*sts.AssumeRoleWithSAMLOutput, error) {
+	f.requested = append(f.requested, *input.DurationSeconds)
+	f.inputs = append(f.inputs, input)
+
+	if *input.DurationSeconds > f.max {
+		return nil, awserr.New("ValidationError", "The requested DurationSeconds exceeds the MaxSessionDuration set for this role.", nil)
+	}
+
+	return &sts.AssumeRoleWithSAMLOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("AKIA"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Duration(*input.DurationSeconds) * time.Second)),
+		},
+	}, nil
+}
+
+func newTestGSuite(t *testing.T, f *fakeSTS) *GSuite {
+	response := loadSAMLResponse(t, "saml_response.xml")
+
+	a, err := ParseSAMLResponse(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &GSuite{samlResponse: response, assertion: a, sts: f}
+}
+
+func TestRetrieveMaxDurationCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		max       int64
+		asserted  time.Duration
+		requested []int64
+		granted   int64
+	}{
+		{"asserted", 43200, 8 * time.Hour, []int64{28800}, 28800},
+		{"step down", 14400, 8 * time.Hour, []int64{28800, 14400}, 14400},
+		{"not asserted", 3600, 0, []int64{43200, 28800, 14400, 3600}, 3600},
+		{"short asserted", 43200, 30 * time.Minute, []int64{1800}, 1800},
+	} {
+		f := &fakeSTS{max: tc.max}
+		g := newTestGSuite(t, f)
+		g.assertion.SessionDuration = tc.asserted
+
+		o, granted, err := g.RetrieveMaxDurationCredentialsContext(context.Background(), "arn:aws:iam::123456789012:role/Admin")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if granted != tc.granted || o.Credentials == nil {
+			t.Errorf("%s: expected %d seconds to be granted, got %d", tc.name, tc.granted, granted)
+		}
+
+		if len(f.requested) != len(tc.requested) {
+			t.Fatalf("%s: expected requests %v, got %v", tc.name, tc.requested, f.requested)
+		}
+
+		for i := range f.requested {
+			if f.requested[i] != tc.requested[i] {
+				t.Errorf("%s: expected requests %v, got %v", tc.name, tc.requested, f.requested)
+			}
+		}
+
+		if principal := *f.inputs[0].PrincipalArn; principal != "arn:aws:iam::123456789012:saml-provider/GoogleApps" {
+			t.Errorf("%s: unexpected principal %s", tc.name, principal)
+		}
+	}
+}
+
+func TestRetrieveMaxDurationCredentialsRefused(t *testing.T) {
+	f := &fakeSTS{max: 900}
+	g := newTestGSuite(t, f)
+
+	if _, _, err := g.RetrieveMaxDurationCredentials("arn:aws:iam::123456789012:role/Admin"); !durationExceeded(err) {
+		t.Errorf("expected a DurationSeconds error, got %v", err)
+	}
+
+	if len(f.requested) != 3 {
+		t.Errorf("expected 3 requests, got %v", f.requested)
+	}
+}
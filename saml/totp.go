@@ -0,0 +1,202 @@
+package saml
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TOTPAlgorithm is the HMAC hash function used to generate TOTP codes.
+type TOTPAlgorithm string
+
+const (
+	// TOTPSHA1 is the algorithm used by Google Authenticator.
+	TOTPSHA1 TOTPAlgorithm = "SHA1"
+	// TOTPSHA256 is the HMAC-SHA-256 variant of RFC 6238.
+	TOTPSHA256 TOTPAlgorithm = "SHA256"
+	// TOTPSHA512 is the HMAC-SHA-512 variant of RFC 6238.
+	TOTPSHA512 TOTPAlgorithm = "SHA512"
+)
+
+// TOTP generates RFC 6238 time-based one-time passwords. The zero values of
+// Digits, Period and Algorithm default to 6, 30 seconds and SHA1.
+type TOTP struct {
+	// Secret is the base32 encoded seed.
+	Secret    string
+	Digits    int
+	Period    time.Duration
+	Algorithm TOTPAlgorithm
+}
+
+func (t *TOTP) digits() int {
+	if t.Digits == 0 {
+		return 6
+	}
+
+	return t.Digits
+}
+
+func (t *TOTP) period() time.Duration {
+	if t.Period == 0 {
+		return 30 * time.Second
+	}
+
+	return t.Period
+}
+
+func (t *TOTP) hash() (func() hash.Hash, error) {
+	switch TOTPAlgorithm(strings.ToUpper(string(t.Algorithm))) {
+	case "", TOTPSHA1:
+		return sha1.New, nil
+	case TOTPSHA256:
+		return sha256.New, nil
+	case TOTPSHA512:
+		return sha512.New, nil
+	default:
+		return nil, errors.Errorf("unsupported TOTP algorithm %q", t.Algorithm)
+	}
+}
+
+func (t *TOTP) key() ([]byte, error) {
+	secret := strings.ToUpper(strings.Replace(t.Secret, " ", "", -1))
+	secret = strings.TrimRight(secret, "=")
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TOTP secret")
+	}
+
+	return key, nil
+}
+
+// validate checks the period and the number of digits, which counter and
+// generate rely on.
+func (t *TOTP) validate() error {
+	if t.period() < time.Second {
+		return errors.Errorf("invalid TOTP period %s", t.Period)
+	}
+
+	if t.digits() < 6 || t.digits() > 10 {
+		return errors.Errorf("invalid number of TOTP digits %d", t.Digits)
+	}
+
+	return nil
+}
+
+// counter returns the RFC 6238 time step for now. The period must be valid.
+func (t *TOTP) counter(now time.Time) uint64 {
+	return uint64(now.Unix() / int64(t.period()/time.Second))
+}
+
+// Generate returns the code for the time step containing now.
+func (t *TOTP) Generate(now time.Time) (string, error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+
+	return t.generate(t.counter(now))
+}
+
+// generate returns the code for the time step counter. The TOTP must be
+// valid.
+func (t *TOTP) generate(counter uint64) (string, error) {
+	h, err := t.hash()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := t.key()
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation as described in RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint64(1)
+	for i := 0; i < t.digits(); i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.digits(), uint64(code)%mod), nil
+}
+
+// TOTPPrompter answers TOTP challenges with codes generated from a TOTP seed
+// and delegates every other prompt to the embedded Prompter.
+type TOTPPrompter struct {
+	Prompter
+	TOTP *TOTP
+
+	used bool
+	last uint64
+}
+
+// NewTOTPPrompter instantiates and returns a *TOTPPrompter. If p is nil,
+// prompts other than the PIN fail with a *NonInteractiveError.
+func NewTOTPPrompter(t *TOTP, p Prompter) *TOTPPrompter {
+	if p == nil {
+		p = NonInteractivePrompter{}
+	}
+
+	return &TOTPPrompter{
+		Prompter: p,
+		TOTP:     t,
+	}
+}
+
+// PIN implements the Prompter interface. A code is never handed out twice:
+// when asked again within the same time step, which happens when Google
+// rejects a code generated right at the period boundary, PIN waits for the
+// next time step.
+func (t *TOTPPrompter) PIN(ctx context.Context, c ChallengeType) (string, error) {
+	if c != ChallengeTOTP {
+		return t.Prompter.PIN(ctx, c)
+	}
+
+	if err := t.TOTP.validate(); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	counter := t.TOTP.counter(now)
+
+	if t.used && counter <= t.last {
+		counter = t.last + 1
+
+		period := int64(t.TOTP.period() / time.Second)
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Until(time.Unix(int64(counter)*period, 0))):
+		}
+	}
+
+	pin, err := t.TOTP.generate(counter)
+	if err != nil {
+		return "", err
+	}
+
+	t.used = true
+	t.last = counter
+
+	return pin, nil
+}
@@ -0,0 +1,109 @@
+package saml
+
+import (
+	"context"
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// TestTOTPVectors checks the test vectors of RFC 6238 Appendix B.
+func TestTOTPVectors(t *testing.T) {
+	seeds := map[TOTPAlgorithm]string{
+		TOTPSHA1:   "12345678901234567890",
+		TOTPSHA256: "12345678901234567890123456789012",
+		TOTPSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	for _, tt := range []struct {
+		unix     int64
+		expected map[TOTPAlgorithm]string
+	}{
+		{59, map[TOTPAlgorithm]string{TOTPSHA1: "94287082", TOTPSHA256: "46119246", TOTPSHA512: "90693936"}},
+		{1111111109, map[TOTPAlgorithm]string{TOTPSHA1: "07081804", TOTPSHA256: "68084774", TOTPSHA512: "25091201"}},
+		{1111111111, map[TOTPAlgorithm]string{TOTPSHA1: "14050471", TOTPSHA256: "67062674", TOTPSHA512: "99943326"}},
+		{1234567890, map[TOTPAlgorithm]string{TOTPSHA1: "89005924", TOTPSHA256: "91819424", TOTPSHA512: "93441116"}},
+		{2000000000, map[TOTPAlgorithm]string{TOTPSHA1: "69279037", TOTPSHA256: "90698825", TOTPSHA512: "38618901"}},
+		{20000000000, map[TOTPAlgorithm]string{TOTPSHA1: "65353130", TOTPSHA256: "77737706", TOTPSHA512: "47863826"}},
+	} {
+		for algorithm, expected := range tt.expected {
+			totp := &TOTP{
+				Secret:    base32.StdEncoding.EncodeToString([]byte(seeds[algorithm])),
+				Digits:    8,
+				Algorithm: algorithm,
+			}
+
+			code, err := totp.Generate(time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if code != expected {
+				t.Errorf("%s at %d: expected %s, got %s", algorithm, tt.unix, expected, code)
+			}
+		}
+	}
+}
+
+func TestTOTPInvalid(t *testing.T) {
+	for _, totp := range []*TOTP{
+		{Secret: "JBSWY3DPEHPK3PXP", Period: 500 * time.Millisecond},
+		{Secret: "JBSWY3DPEHPK3PXP", Period: -time.Second},
+		{Secret: "JBSWY3DPEHPK3PXP", Digits: 4},
+		{Secret: "JBSWY3DPEHPK3PXP", Digits: 11},
+	} {
+		if _, err := totp.Generate(time.Now()); err == nil {
+			t.Errorf("expected period %s and %d digits to be rejected", totp.Period, totp.Digits)
+		}
+
+		if _, err := NewTOTPPrompter(totp, nil).PIN(context.Background(), ChallengeTOTP); err == nil {
+			t.Errorf("expected the prompter to reject period %s and %d digits", totp.Period, totp.Digits)
+		}
+	}
+}
+
+func TestTOTPPrompterNextStep(t *testing.T) {
+	// The period is long enough for both prompts to fall in the same step.
+	p := NewTOTPPrompter(&TOTP{Secret: "JBSWY3DPEHPK3PXP", Period: time.Hour}, nil)
+
+	if _, err := p.PIN(context.Background(), ChallengeTOTP); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A code rejected right at the boundary is not handed out again, the
+	// prompter waits for the next time step instead.
+	if _, err := p.PIN(cancelled, ChallengeTOTP); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if _, err := p.PIN(context.Background(), ChallengeSMS); err == nil {
+		t.Error("expected the SMS prompt to be delegated to the non-interactive prompter")
+	}
+
+	totp := &TOTP{Secret: "JBSWY3DPEHPK3PXP", Period: time.Second}
+	p = NewTOTPPrompter(totp, nil)
+
+	first, err := p.PIN(context.Background(), ChallengeTOTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := p.last
+
+	second, err := p.PIN(context.Background(), ChallengeTOTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := totp.generate(p.last)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.last <= last || p.last > totp.counter(time.Now()) || second != expected {
+		t.Errorf("expected the code %s of the next step, got %s after %s", expected, second, first)
+	}
+}
@@ -0,0 +1,298 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// defaultAudience is the audience AWS requires in the assertion.
+const defaultAudience = "urn:amazon:webservices"
+
+// defaultClockSkew is the tolerance applied to the conditions of the
+// assertion when the policy does not set one.
+const defaultClockSkew = time.Minute
+
+// ValidationPolicy describes what a SAML assertion is checked against.
+type ValidationPolicy struct {
+	// Certificates are the signing certificates of the IdP. The XML
+	// signature is only verified when at least one is set.
+	Certificates []*x509.Certificate
+	// ClockSkew is the tolerance applied to NotBefore and NotOnOrAfter. It
+	// defaults to one minute.
+	ClockSkew time.Duration
+	// Audience defaults to urn:amazon:webservices.
+	Audience string
+	// Destination is the URL the SAMLResponse is posted to. It is not
+	// checked when empty, except during a login which sets it to the AWS
+	// sign-in URL.
+	Destination string
+	// Issuer is the entity ID of the IdP. It is not checked when empty.
+	Issuer string
+	// Now returns the current time and defaults to time.Now.
+	Now func() time.Time
+}
+
+// Validate checks the signature and the conditions of the assertion against
+// p. The first failure is returned as an *AssertionError. Once the signature
+// is verified, the fields of a only hold what is covered by the signature.
+func (a *Assertion) Validate(p ValidationPolicy) error {
+	now := time.Now()
+	if p.Now != nil {
+		now = p.Now()
+	}
+
+	skew := p.ClockSkew
+	if skew == 0 {
+		skew = defaultClockSkew
+	}
+
+	if len(p.Certificates) > 0 {
+		if err := a.verifySignature(p.Certificates, now); err != nil {
+			return &AssertionError{Err: ErrInvalidSignature, Detail: err.Error()}
+		}
+	}
+
+	if !a.NotBefore.IsZero() && now.Add(skew).Before(a.NotBefore) {
+		return &AssertionError{
+			Err:    ErrAssertionNotYetValid,
+			Detail: "NotBefore is " + formatInstant(a.NotBefore) + ", now is " + formatInstant(now),
+		}
+	}
+
+	if !a.NotOnOrAfter.IsZero() && !now.Add(-skew).Before(a.NotOnOrAfter) {
+		return &AssertionError{
+			Err:    ErrAssertionExpired,
+			Detail: "NotOnOrAfter is " + formatInstant(a.NotOnOrAfter) + ", now is " + formatInstant(now),
+		}
+	}
+
+	audience := p.Audience
+	if audience == "" {
+		audience = defaultAudience
+	}
+
+	if !contains(a.Audience, audience) {
+		return &AssertionError{
+			Err:    ErrAudienceMismatch,
+			Detail: "expected " + audience + ", asserted " + list(a.Audience),
+		}
+	}
+
+	if p.Destination != "" {
+		for _, destination := range []string{a.Destination, a.Recipient} {
+			if destination != "" && destination != p.Destination {
+				return &AssertionError{
+					Err:    ErrDestinationMismatch,
+					Detail: "expected " + p.Destination + ", asserted " + destination,
+				}
+			}
+		}
+
+		if a.Destination == "" && a.Recipient == "" {
+			return &AssertionError{
+				Err:    ErrDestinationMismatch,
+				Detail: "expected " + p.Destination + ", asserted none",
+			}
+		}
+	}
+
+	if p.Issuer != "" && a.Issuer != p.Issuer {
+		return &AssertionError{
+			Err:    ErrIssuerMismatch,
+			Detail: "expected " + p.Issuer + ", asserted " + a.Issuer,
+		}
+	}
+
+	return nil
+}
+
+// verifySignature verifies the enveloped signature of either the response
+// or the assertion, and replaces the content of a with the signed element so
+// that nothing outside of the signature can be injected.
+func (a *Assertion) verifySignature(certs []*x509.Certificate, now time.Time) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(a.raw); err != nil {
+		return err
+	}
+
+	response := doc.Root()
+	if response == nil {
+		return errors.New("empty SAML response")
+	}
+
+	if n := len(response.SelectElements("Assertion")); n != 1 {
+		return errors.Errorf("expected one assertion, found %d", n)
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certs})
+	ctx.Clock = dsig.NewFakeClockAt(now)
+
+	var (
+		destination = a.Destination
+		issuer      string
+		signed      *etree.Element
+	)
+
+	if response.SelectElement("Signature") != nil {
+		validated, err := ctx.Validate(response)
+		if err != nil {
+			return err
+		}
+
+		destination = validated.SelectAttrValue("Destination", "")
+
+		if el := validated.SelectElement("Issuer"); el != nil {
+			issuer = el.Text()
+		}
+
+		if signed = validated.SelectElement("Assertion"); signed == nil {
+			return errors.New("signed SAML response has no assertion")
+		}
+	} else {
+		// The response envelope is not signed, only its Destination is kept
+		// and checked against the Recipient of the signed assertion.
+		validated, err := ctx.Validate(response.SelectElement("Assertion"))
+		if err != nil {
+			return err
+		}
+
+		signed = validated
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(signed.Copy())
+
+	raw, err := out.WriteToBytes()
+	if err != nil {
+		return err
+	}
+
+	var x xmlAssertion
+	if err = xml.Unmarshal(raw, &x); err != nil {
+		return err
+	}
+
+	verified, err := newAssertion(destination, issuer, &x, a.raw)
+	if err != nil {
+		return err
+	}
+
+	*a = *verified
+
+	return nil
+}
+
+func formatInstant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func list(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+
+	return strings.Join(values, ", ")
+}
+
+type xmlMetadata struct {
+	KeyDescriptors []struct {
+		Use          string   `xml:"use,attr"`
+		Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+	} `xml:"IDPSSODescriptor>KeyDescriptor"`
+}
+
+// ParseIdPCertificates parses the signing certificates of the IdP from PEM
+// encoded certificates, or from the IdP metadata XML that can be downloaded
+// from the Google Admin console.
+func ParseIdPCertificates(data []byte) (certs []*x509.Certificate, err error) {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "<") {
+		return parseMetadataCertificates(data)
+	}
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse IdP certificate")
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no IdP certificate found")
+	}
+
+	return certs, nil
+}
+
+func parseMetadataCertificates(data []byte) (certs []*x509.Certificate, err error) {
+	var m xmlMetadata
+	if err = xml.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "failed to parse IdP metadata")
+	}
+
+	for _, kd := range m.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+
+		for _, encoded := range kd.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to decode IdP certificate")
+			}
+
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to parse IdP certificate")
+			}
+
+			certs = append(certs, cert)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no signing certificate found in IdP metadata")
+	}
+
+	return certs, nil
+}
+
+// LoadIdPCertificates reads the IdP certificates from a PEM or metadata XML
+// file. See ParseIdPCertificates.
+func LoadIdPCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseIdPCertificates(data)
+}
@@ -0,0 +1,90 @@
+package saml
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestValidateConditions(t *testing.T) {
+	a, err := ParseSAMLResponse(loadSAMLResponse(t, "saml_response.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(s string) func() time.Time {
+		return func() time.Time {
+			now, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return now
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		policy   ValidationPolicy
+		expected error
+	}{
+		{"valid", ValidationPolicy{Now: at("2019-05-01T10:00:00Z")}, nil},
+		{"skew before", ValidationPolicy{Now: at("2019-05-01T09:54:30Z")}, nil},
+		{"skew after", ValidationPolicy{Now: at("2019-05-01T10:05:30Z")}, nil},
+		{"not yet valid", ValidationPolicy{Now: at("2019-05-01T09:53:00Z")}, ErrAssertionNotYetValid},
+		{"expired", ValidationPolicy{Now: at("2019-05-01T10:07:00Z")}, ErrAssertionExpired},
+		{"expired without skew", ValidationPolicy{Now: at("2019-05-01T10:05:30Z"), ClockSkew: time.Nanosecond}, ErrAssertionExpired},
+		{"audience", ValidationPolicy{Now: at("2019-05-01T10:00:00Z"), Audience: "urn:example"}, ErrAudienceMismatch},
+		{"destination", ValidationPolicy{Now: at("2019-05-01T10:00:00Z"), Destination: "https://signin.amazonaws.cn/saml"}, ErrDestinationMismatch},
+		{"matching destination", ValidationPolicy{Now: at("2019-05-01T10:00:00Z"), Destination: "https://signin.aws.amazon.com/saml"}, nil},
+		{"issuer", ValidationPolicy{Now: at("2019-05-01T10:00:00Z"), Issuer: "https://accounts.google.com/o/saml2?idpid=other"}, ErrIssuerMismatch},
+	} {
+		err := a.Validate(tc.policy)
+		if tc.expected == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+
+			continue
+		}
+
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, err)
+		}
+
+		var aerr *AssertionError
+		if !errors.As(err, &aerr) || aerr.Detail == "" {
+			t.Errorf("%s: expected an *AssertionError with details, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestValidateUnsigned(t *testing.T) {
+	a, err := ParseSAMLResponse(loadSAMLResponse(t, "saml_response.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := LoadIdPCertificates(filepath.Join("testdata", "idp_certificate.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := func() time.Time { return a.NotBefore }
+
+	if err = a.Validate(ValidationPolicy{Certificates: certs, Now: now}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestParseIdPCertificates(t *testing.T) {
+	if _, err := ParseIdPCertificates([]byte("not a certificate")); err == nil {
+		t.Error("expected an error")
+	}
+
+	if _, err := ParseIdPCertificates([]byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"/>`)); err == nil {
+		t.Error("expected an error for metadata without certificates")
+	}
+}